@@ -0,0 +1,172 @@
+package p1
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+/**
+CachedNodeStore is a NodeStore keeping the recently used nodes of a slower store in memory (LRU).
+(1) The cache holds at most budget bytes of nodes, the least recently used nodes are evicted first.
+(2) Put doesn't write to the slower store: the node is dirty until Flush, which writes all the dirty nodes
+in one batch. Commit and CollectGarbage flush the store of the trie.
+(3) A dirty node that is evicted is written to the slower store first.
+ */
+type CachedNodeStore struct {
+	backing NodeStore
+	budget  int
+	size    int
+	lru     *list.List               //front: most recently used
+	entries map[string]*list.Element //value: *cache_entry
+	hits    int
+	misses  int
+	lock    sync.Mutex
+}
+
+type cache_entry struct {
+	hash  string
+	node  Node
+	size  int
+	dirty bool
+}
+
+/**
+CacheStats are the counters of a CachedNodeStore.
+ */
+type CacheStats struct {
+	Hits    int
+	Misses  int
+	Entries int
+	Bytes   int
+	Dirty   int
+}
+
+/**
+Create a cache of budget bytes in front of backing
+Return type: *CachedNodeStore
+ */
+func NewCachedNodeStore(backing NodeStore, budget int) *CachedNodeStore {
+	return &CachedNodeStore{
+		backing: backing,
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (store *CachedNodeStore) Get(hash string) (Node, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if element, ok := store.entries[hash]; ok {
+		store.hits++
+		store.lru.MoveToFront(element)
+		return element.Value.(*cache_entry).node, true
+	}
+	store.misses++
+	node, ok := store.backing.Get(hash)
+	if ok {
+		store.add(hash, node, false)
+	}
+	return node, ok
+}
+
+func (store *CachedNodeStore) Put(hash string, node Node) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if element, ok := store.entries[hash]; ok {
+		store.remove(element)
+	}
+	store.add(hash, node, true)
+}
+
+func (store *CachedNodeStore) Delete(hash string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if element, ok := store.entries[hash]; ok {
+		store.remove(element)
+	}
+	store.backing.Delete(hash)
+}
+
+func (store *CachedNodeStore) Hashes() []string {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	hashes := store.backing.Hashes()
+	seen := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		seen[hash] = true
+	}
+	for hash := range store.entries {
+		if !seen[hash] {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+/**
+Description: Write the dirty nodes to the slower store in one batch, and flush it if it can be flushed.
+Return: error
+ */
+func (store *CachedNodeStore) Flush() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var dirty []*cache_entry
+	for _, element := range store.entries {
+		if entry := element.Value.(*cache_entry); entry.dirty {
+			dirty = append(dirty, entry)
+		}
+	}
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i].hash < dirty[j].hash })
+	for _, entry := range dirty {
+		store.backing.Put(entry.hash, entry.node)
+		entry.dirty = false
+	}
+	if backing, ok := store.backing.(Flusher); ok {
+		return backing.Flush()
+	}
+	return nil
+}
+
+/**
+Description: Get the counters of the cache.
+Return: CacheStats
+ */
+func (store *CachedNodeStore) Stats() CacheStats {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	stats := CacheStats{Hits: store.hits, Misses: store.misses, Entries: len(store.entries), Bytes: store.size}
+	for _, element := range store.entries {
+		if element.Value.(*cache_entry).dirty {
+			stats.Dirty++
+		}
+	}
+	return stats
+}
+
+/**
+Description: Add a node to the cache, and evict the least recently used nodes over the budget.
+The caller holds the lock.
+Arguments: hash (string), node (Node), dirty (bool)
+ */
+func (store *CachedNodeStore) add(hash string, node Node, dirty bool) {
+	entry := &cache_entry{hash: hash, node: node, size: len(hash) + node_size(node), dirty: dirty}
+	store.entries[hash] = store.lru.PushFront(entry)
+	store.size += entry.size
+	for store.size > store.budget && store.lru.Len() > 0 {
+		oldest := store.lru.Back()
+		evicted := oldest.Value.(*cache_entry)
+		if evicted.dirty {
+			store.backing.Put(evicted.hash, evicted.node)
+		}
+		store.remove(oldest)
+	}
+}
+
+func (store *CachedNodeStore) remove(element *list.Element) {
+	entry := element.Value.(*cache_entry)
+	store.lru.Remove(element)
+	delete(store.entries, entry.hash)
+	store.size -= entry.size
+}
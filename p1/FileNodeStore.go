@@ -0,0 +1,399 @@
+package p1
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/**
+FileNodeStore keeps the nodes of a trie on disk, so a trie can be bigger than RAM and can be reopened later.
+It uses two files in a directory:
+(1) nodes.dat: an append-only data file. Every line is a JSON record {"op":"put"/"delete", "hash", "node"}.
+(2) nodes.wal: the write-ahead log. Put and Delete append their record to the log with one write,
+and Flush syncs the log and moves the logged records to the data file (Commit flushes the store).
+If the process stops before Flush, the records in the log are replayed the next time the store is opened,
+and an incomplete last record is cut off. A crash of the machine can lose the records after the last Flush.
+The logged nodes are kept in memory until they are flushed, so Put flushes by itself
+when more than maxPending nodes are logged (DefaultMaxPending, see SetMaxPending).
+Only the location of the flushed nodes is kept in memory.
+I/O errors are sticky: the first one is kept and returned by Err, Flush and Close.
+ */
+type FileNodeStore struct {
+	dir        string
+	data       *os.File
+	wal        *os.File
+	size       int64                    //size of the data file
+	index      map[string]file_location //nodes in the data file
+	pending    map[string]*Node         //nodes in the log, nil means deleted
+	maxPending int
+	lock       sync.Mutex
+	err        error
+}
+
+/**
+The number of logged nodes after which Put flushes the store.
+ */
+const DefaultMaxPending = 4096
+
+type file_location struct {
+	offset int64
+	length int
+}
+
+/**
+node_record is one line of the data file or the log.
+ */
+type node_record struct {
+	Op   string     `json:"op"`
+	Hash string     `json:"hash"`
+	Node *node_json `json:"node,omitempty"`
+}
+
+/**
+node_json is the JSON format of a Node.
+ */
+type node_json struct {
+	Type   int      `json:"type"`
+	Branch []string `json:"branch,omitempty"`
+	Prefix []uint8  `json:"prefix,omitempty"`
+	Value  string   `json:"value,omitempty"`
+}
+
+func node_to_json(node Node) node_json {
+	nj := node_json{Type: node.node_type}
+	switch node.node_type {
+	case 1:
+		nj.Branch = append([]string{}, node.branch_value[:]...)
+	case 2:
+		nj.Prefix = append([]uint8{}, node.flag_value.encoded_prefix...)
+		nj.Value = node.flag_value.value
+	}
+	return nj
+}
+
+func json_to_node(nj node_json) (Node, error) {
+	node := Node{node_type: nj.Type}
+	switch nj.Type {
+	case 1:
+		if len(nj.Branch) != 17 {
+			return Node{}, &CorruptNodeError{Reason: "branch must have 17 values"}
+		}
+		copy(node.branch_value[:], nj.Branch)
+	case 2:
+		if len(nj.Prefix) == 0 {
+			return Node{}, &CorruptNodeError{Reason: "missing prefix"}
+		}
+		node.flag_value = Flag_value{append([]uint8{}, nj.Prefix...), nj.Value}
+	default:
+		return Node{}, &CorruptNodeError{Reason: "unknown node type"}
+	}
+	return node, nil
+}
+
+/**
+Open the file store in directory dir, create it if it doesn't exist.
+Return type: *FileNodeStore, error
+ */
+func OpenFileNodeStore(dir string) (*FileNodeStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(dir, "nodes.dat"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, "nodes.wal"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	store := &FileNodeStore{
+		dir:        dir,
+		data:       data,
+		wal:        wal,
+		index:      make(map[string]file_location),
+		pending:    make(map[string]*Node),
+		maxPending: DefaultMaxPending,
+	}
+	//1.load the locations of the nodes in the data file
+	store.size, err = read_records(data, func(record node_record, location file_location) error {
+		if record.Op == "delete" {
+			delete(store.index, record.Hash)
+		} else {
+			store.index[record.Hash] = location
+		}
+		return nil
+	})
+	if err == nil {
+		//2.replay the log
+		_, err = read_records(wal, func(record node_record, location file_location) error {
+			if record.Op == "delete" || record.Node == nil {
+				store.pending[record.Hash] = nil
+				return nil
+			}
+			node, err := json_to_node(*record.Node)
+			if err != nil {
+				return err
+			}
+			store.pending[record.Hash] = &node
+			return nil
+		})
+	}
+	if err != nil {
+		data.Close()
+		wal.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+/**
+Description: Set the number of logged nodes after which Put flushes the store, 0 means never.
+Arguments: count (int)
+ */
+func (store *FileNodeStore) SetMaxPending(count int) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.maxPending = count
+}
+
+/**
+Description:
+Read all the complete records of file, and call handle for each of them.
+An incomplete last line (the process stopped while writing it) is cut off.
+Arguments: file (*os.File), handle (func)
+Return: the size of the file after the last complete record, error
+ */
+func read_records(file *os.File, handle func(node_record, file_location) error) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return offset, err
+		}
+		record := node_record{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return offset, &CorruptNodeError{Reason: err.Error()}
+		}
+		if err := handle(record, file_location{offset, len(line)}); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+	if err := file.Truncate(offset); err != nil {
+		return offset, err
+	}
+	_, err := file.Seek(offset, io.SeekStart)
+	return offset, err
+}
+
+func (store *FileNodeStore) Get(hash string) (Node, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if node, ok := store.pending[hash]; ok {
+		if node == nil {
+			return Node{}, false
+		}
+		return *node, true
+	}
+	location, ok := store.index[hash]
+	if !ok {
+		return Node{}, false
+	}
+	line := make([]byte, location.length)
+	if _, err := store.data.ReadAt(line, location.offset); err != nil {
+		store.set_err(err)
+		return Node{}, false
+	}
+	record := node_record{}
+	if err := json.Unmarshal(line, &record); err != nil || record.Node == nil {
+		store.set_err(&CorruptNodeError{Hash: hash, Reason: "unreadable record"})
+		return Node{}, false
+	}
+	node, err := json_to_node(*record.Node)
+	if err != nil {
+		store.set_err(err)
+		return Node{}, false
+	}
+	return node, true
+}
+
+func (store *FileNodeStore) Put(hash string, node Node) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	nj := node_to_json(node)
+	store.log(node_record{"put", hash, &nj})
+	store.pending[hash] = &node
+	if store.maxPending > 0 && len(store.pending) >= store.maxPending {
+		store.flush()
+	}
+}
+
+func (store *FileNodeStore) Delete(hash string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	node, in_log := store.pending[hash]
+	_, in_data := store.index[hash]
+	if (in_log && node == nil) || (!in_log && !in_data) {
+		//nothing to delete
+		return
+	}
+	store.log(node_record{"delete", hash, nil})
+	store.pending[hash] = nil
+}
+
+func (store *FileNodeStore) Hashes() []string {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	hashes := make([]string, 0, len(store.index)+len(store.pending))
+	for hash := range store.index {
+		if _, ok := store.pending[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	for hash, node := range store.pending {
+		if node != nil {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+/**
+Description:
+Flush makes the logged changes durable: the log is synced to disk,
+then the records are appended to the data file, and the log is emptied.
+Return: error
+ */
+func (store *FileNodeStore) Flush() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.flush()
+}
+
+/**
+Description: Flush, the caller holds the lock.
+Return: error
+ */
+func (store *FileNodeStore) flush() error {
+	if store.err != nil || len(store.pending) == 0 {
+		return store.err
+	}
+	//1.the log is on disk before the data file changes
+	if err := store.wal.Sync(); err != nil {
+		store.set_err(err)
+		return err
+	}
+	//2.append the records to the data file, in a fixed order
+	hashes := make([]string, 0, len(store.pending))
+	for hash := range store.pending {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	buffer := []byte{}
+	locations := make(map[string]file_location)
+	for _, hash := range hashes {
+		record := node_record{"delete", hash, nil}
+		if node := store.pending[hash]; node != nil {
+			nj := node_to_json(*node)
+			record = node_record{"put", hash, &nj}
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			store.set_err(err)
+			return err
+		}
+		line = append(line, '\n')
+		locations[hash] = file_location{store.size + int64(len(buffer)), len(line)}
+		buffer = append(buffer, line...)
+	}
+	if _, err := store.data.WriteAt(buffer, store.size); err != nil {
+		store.set_err(err)
+		return err
+	}
+	if err := store.data.Sync(); err != nil {
+		store.set_err(err)
+		return err
+	}
+	store.size += int64(len(buffer))
+	for _, hash := range hashes {
+		if store.pending[hash] == nil {
+			delete(store.index, hash)
+		} else {
+			store.index[hash] = locations[hash]
+		}
+	}
+	//3.the records are in the data file, empty the log
+	store.pending = make(map[string]*Node)
+	if err := store.wal.Truncate(0); err != nil {
+		store.set_err(err)
+		return err
+	}
+	if _, err := store.wal.Seek(0, io.SeekStart); err != nil {
+		store.set_err(err)
+		return err
+	}
+	return nil
+}
+
+/**
+Description: Flush the logged changes and close the files.
+Return: error
+ */
+func (store *FileNodeStore) Close() error {
+	err := store.Flush()
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if e := store.wal.Close(); err == nil {
+		err = e
+	}
+	if e := store.data.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+/**
+Return: the first I/O error of the store, nil if there is none.
+ */
+func (store *FileNodeStore) Err() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.err
+}
+
+/**
+Description: append a record to the log, in one write so that it is complete or cut off at replay.
+The caller holds the lock.
+ */
+func (store *FileNodeStore) log(record node_record) {
+	if store.err != nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		store.set_err(err)
+		return
+	}
+	if _, err := store.wal.Write(append(line, '\n')); err != nil {
+		store.set_err(err)
+	}
+}
+
+func (store *FileNodeStore) set_err(err error) {
+	if store.err == nil {
+		store.err = err
+	}
+}
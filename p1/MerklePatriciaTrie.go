@@ -2,12 +2,13 @@ package p1
 
 import (
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"golang.org/x/crypto/sha3"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 /**
@@ -31,72 +32,154 @@ type Node struct {
 /**
 Struct MerklePatriciaTrie
 This class represent a Merkle Patricia Trie. It has two variables: "db" and "root".
-Variable "db" is a HashMap. The key of the HashMap is a Node's hash value. The value of the HashMap is the Node.
+Variable "db" is a NodeStore. The key of the NodeStore is a Node's hash value. The value of the NodeStore is the Node.
+Identical nodes are stored once, so Insert and Delete never delete a node in place: replaced nodes stay in db
+until CollectGarbage.
 Variable "root" is a String, which is the hash value of the root node.
+Variable "shared" is the state of db: the lock and the live forks.
+Copies of a trie share the same db, so they also share this state.
+Variable "fork" is the fork of the trie: its committed versions and its live root. Clone() creates a new fork.
+A copy by assignment (b := mpt) keeps the fork of the trie, and CollectGarbage only keeps the last root
+written by one of the copies: pass the roots of the other copies in extra_roots, or use Clone().
+Readers (Get, GetMptMap, String...) can run concurrently, Insert and Delete are exclusive.
  */
 type MerklePatriciaTrie struct {
-	db   map[string]Node //map: key( Node's hash value) value(Node)
-	root string
+	db     NodeStore //key( Node's hash value) value(Node)
+	root   string
+	shared *mpt_shared
+	fork   *mpt_fork
 }
+
 /**
-store key and value
-Example:
-"a" -> "apple"
+mpt_shared is shared by all the copies of a trie.
+Variable "lock" protects db, root and the forks.
+Variable "generation" counts the write locks, a session uses it to know if another writer used db.
+Variable "sessions" is the set of open sessions, their nodes are live for CollectGarbage.
+Variable "forks" is the set of forks not released, their roots and versions are live for CollectGarbage.
+Clone() only holds the read lock, so "forks_lock" protects the set and the roots of the forks.
+Variable "id" orders the locks of two tries, see read_lock_pair.
  */
+type mpt_shared struct {
+	id         uint64
+	lock       sync.RWMutex
+	generation uint64
+	sessions   map[*MptSession]bool
+	forks      map[*mpt_fork]bool
+	forks_lock sync.Mutex
+}
 
-var mptMap = make(map[string]string)
-
+/**
+mpt_fork is shared by the copies of a trie, Clone() creates a new one.
+Variable "root" is the last root written by a copy, see write_unlock. It is the only live root of the copies.
+Variable "versions" is the list of committed roots of the fork, see Commit().
+ */
+type mpt_fork struct {
+	root     string
+	versions []string
+}
 
 /**
 Get the root from mpt.
 Return: the root of mpt (string).
  */
 func (mpt *MerklePatriciaTrie) GetRoot() string{
+	mpt.read_lock()
+	defer mpt.read_unlock()
 	return mpt.root
 }
+
+/**
+Lock helpers. A trie created without Initial() has no lock, and is not safe for concurrent use.
+ */
+func (mpt *MerklePatriciaTrie) read_lock() {
+	if mpt.shared != nil {
+		mpt.shared.lock.RLock()
+	}
+}
+
+func (mpt *MerklePatriciaTrie) read_unlock() {
+	if mpt.shared != nil {
+		mpt.shared.lock.RUnlock()
+	}
+}
+
+func (mpt *MerklePatriciaTrie) write_lock() {
+	if mpt.shared != nil {
+		mpt.shared.lock.Lock()
+	}
+}
+
+func (mpt *MerklePatriciaTrie) write_unlock() {
+	if mpt.shared != nil {
+		mpt.shared.generation++
+		if mpt.fork != nil {
+			mpt.shared.forks_lock.Lock()
+			mpt.fork.root = mpt.root
+			mpt.shared.forks_lock.Unlock()
+		}
+		mpt.shared.lock.Unlock()
+	}
+}
+
+/**
+Description: Read lock two tries in a fixed order (the id of their shared state), so that two goroutines
+locking the same tries in opposite order can't deadlock. Copies of a trie are locked once.
+Arguments: a (*MerklePatriciaTrie), b (*MerklePatriciaTrie)
+Return: the function unlocking them
+ */
+func read_lock_pair(a *MerklePatriciaTrie, b *MerklePatriciaTrie) func() {
+	if a.shared == b.shared || b.shared == nil {
+		a.read_lock()
+		return a.read_unlock
+	}
+	if a.shared == nil {
+		b.read_lock()
+		return b.read_unlock
+	}
+	if b.shared.id < a.shared.id {
+		a, b = b, a
+	}
+	a.read_lock()
+	b.read_lock()
+	return func() {
+		b.read_unlock()
+		a.read_unlock()
+	}
+}
+
+/**
+shared_ids numbers the shared states.
+ */
+var shared_ids uint64
+
 /**
 Description:
 The Get function takes a key as argument,
 traverses down the Merkle Patricia Trie to find the value, and returns it.
-If the key doesn't exist, it will return an empty string.
-(for the Go version: if the key is nil, Get returns an empty string.)
+If the key doesn't exist, it will return an empty string and ErrPathNotFound,
+a missing or corrupt node of db is a *MissingNodeError or a *CorruptNodeError.
+It is a wrapper of GetBytes.
 Arguments: key (string) --"abc"
 Return: the value stored for that key (string).
 Rust function definition: fn get(&mut self, key: &str) -> String
 Go function definition: func (mpt *MerklePatriciaTrie) Get(key string) string
  */
 func (mpt *MerklePatriciaTrie) Get(key string) (string, error) {
-	var value string
-	var err error
-	if mpt == nil {
-		value = ""
-		err = errors.New("path_not_found")
-	} else {
-		//convert string to hex array [1,6,1]
-		hex_array := stringToHex_array(key)
-		if key == "" {
-			value = ""
-			err = errors.New("path_not_found")
-		} else {
-			//get helper
-			value, err = mpt.get_helper(hex_array, mpt.root)
-		}
-	}
-	return value, err
+	value, err := mpt.GetBytes([]byte(key))
+	return string(value), err
 }
 
 /**
 Description:
 Insert() function takes a pair of <key, value> as arguments.
 It will traverse down the Merkle Patricia Trie, find the right place to insert the value,and do the insertion.
+It is a wrapper of InsertBytes.
 Arguments: key(String), value(String)
 For example: ("a","apple")
-Return: None
+Return: error *MissingNodeError or *CorruptNodeError if a node of the path is broken, the trie is not changed then.
  */
-func (mpt *MerklePatriciaTrie) Insert(key string, new_value string) {
-	hex_array := stringToHex_array(key)
-	node_hash := mpt.insert_helper(hex_array, new_value, mpt.root)
-	mpt.root = node_hash
+func (mpt *MerklePatriciaTrie) Insert(key string, new_value string) error {
+	return mpt.InsertBytes([]byte(key), []byte(new_value))
 }
 
 /**
@@ -104,31 +187,19 @@ Description:
 The Delete function takes a key as argument,
 traverses the Merkle Patricia Trie and finds that key.
 If the key exists, delete the corresponding value and re-balance the trie if necessary,
-then return an empty string; if the key doesn't exist, return "path_not_found".
+then return the new root; if the key doesn't exist, return ErrPathNotFound.
 Arguments: key (string)
 Return: string
 Rust function definition: fn delete(&mut self, key: &str) -> String
 Go function definition: func (mpt *MerklePatriciaTrie) Delete(key string) string
  */
 func (mpt *MerklePatriciaTrie) Delete(key string) (string, error) {
-	var value string
-	var err error
-	hex_array := stringToHex_array(key)
 	if mpt == nil {
-		value = ""
-		err = errors.New("path_not_found")
-	} else {
-		//var result string
-		value = mpt.delete_helper(hex_array, mpt.root)
-		if value == "path_not_found" {
-			value = ""
-			err = errors.New("path_not_found")
-		} else {
-			mpt.root = value
-		}
-
+		return "", ErrPathNotFound
 	}
-	return value, err
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	return mpt.delete_key(stringToHex_array(key))
 }
 
 /**
@@ -229,29 +300,29 @@ Return: the value stored for that key (string), error.
 func (mpt *MerklePatriciaTrie) get_helper(hex_array []uint8, hash string) (string, error) {
 	var value string
 	var err error
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 
 	switch curNode.node_type {
 	case 0: //NULL
 		value = ""
-		err = errors.New("path_not_found")
+		err = ErrPathNotFound
+		if hash != "" {
+			err = &MissingNodeError{hash}
+		}
 	case 1: //Branch Node
 		value, err = mpt.branch_get_helper(hex_array, hash)
 	case 2:                                                //Ext or Leaf
+		if !valid_compact_prefix(curNode.flag_value.encoded_prefix) {
+			return "", &CorruptNodeError{Hash: hash, Reason: "bad compact prefix"}
+		}
 		encodedPrefix := curNode.flag_value.encoded_prefix //[17,97]
 		decode_array := compact_decode(encodedPrefix)      //[1,6,1]
 		prefix := encodedPrefix[0] / 16
 		//check every element in two arrays(hex_array and decode_array)
-		if len(hex_array) < len(decode_array) {
+		if common_length(hex_array, decode_array) != len(decode_array) {
 			value = ""
-			err = errors.New("path_not_found")
+			err = ErrPathNotFound
 		} else {
-			for i := 0; i < len(decode_array); i++ {
-				if hex_array[i] != decode_array[i] {
-					value = ""
-					err = errors.New("path_not_found")
-				}
-			}
 			hex_array = hex_array[len(decode_array):]
 			if prefix == 2 || prefix == 3 { //leaf
 				value, err = mpt.leaf_get_helper(hex_array, hash)
@@ -273,14 +344,22 @@ Return: the value stored for that key (string), error.
 func (mpt *MerklePatriciaTrie) branch_get_helper(hex_array []uint8, hash string) (string, error) {
 	var value string
 	var err error
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 
+	//the key ends at this branch, the value is stored in the last slot
+	if len(hex_array) == 0 {
+		value, found := unwrap_branch_value(curNode.branch_value[16])
+		if !found {
+			err = ErrPathNotFound
+		}
+		return value, err
+	}
 	nextNode := curNode.branch_value[hex_array[0]]
 	rest_path := hex_array[1:]
 	//if the hash value of next node is nil, Get returns an empty string.
 	if nextNode == "" {
 		value = ""
-		err = errors.New("path_not_found")
+		err = ErrPathNotFound
 	} else {
 		value, err = mpt.get_helper(rest_path, nextNode)
 	}
@@ -296,12 +375,12 @@ Return: the value stored for that key (string), error.
 func (mpt *MerklePatriciaTrie) leaf_get_helper(hex_array []uint8, hash string) (string, error) {
 	var value string
 	var err error
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	if len(hex_array) == 0 {
 		value = curNode.flag_value.value
 	} else {
 		value = ""
-		err = errors.New("path_not_found")
+		err = ErrPathNotFound
 	}
 	return value, err
 }
@@ -315,12 +394,9 @@ Return: the value stored for that key (string), error.
 func (mpt *MerklePatriciaTrie) extension_get_helper(hex_array []uint8, hash string) (string, error) {
 	var value string
 	var err error
-	curNode := mpt.db[hash]
-	if len(hex_array) == 0 {
-		value = mpt.db[curNode.flag_value.value].branch_value[16]
-	} else {
-		value, err = mpt.get_helper(hex_array, curNode.flag_value.value)
-	}
+	curNode := mpt.get_node(hash)
+	//the next node of ext node is always a branch, which also handles an empty hex_array
+	value, err = mpt.get_helper(hex_array, curNode.flag_value.value)
 	return value, err
 }
 
@@ -331,13 +407,12 @@ Arguments: hex_array(array of u8), new_value(string), hash(string)
 Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) insert_helper(hex_array []uint8, new_value string, hash string) string {
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	//delete(mpt.db, hash)
 	var node_hash string //hash value of current node
 
 	switch curNode.node_type {
 	case 0: //NULL
-		delete(mpt.db, hash)
 		//insert root node, it should be leaf node
 		node_hash = mpt.create_leaf_node(hex_array, new_value)
 		//mpt.db = curNode
@@ -347,8 +422,7 @@ func (mpt *MerklePatriciaTrie) insert_helper(hex_array []uint8, new_value string
 	case 2:                                                //Ext or Leaf
 		encodedPrefix := curNode.flag_value.encoded_prefix //[17,97]
 		prefix := encodedPrefix[0] / 16
-		//current node is leaf node, if we create a new leaf node with the original value, we keep it.
-		//if we create a new leaf node with the new value, we delete the old one which store in db
+		//the replaced nodes stay in db, they are deleted by CollectGarbage
 		if prefix == 2 || prefix == 3 { //Leaf Node
 			node_hash = mpt.leaf_insert_helper(hex_array, new_value, hash)
 		} else { //Ext Node
@@ -365,12 +439,11 @@ Arguments: hex_array(array of u8), new_value(string), hash(string)
 Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) branch_insert_helper(hex_array []uint8, new_value string, hash string) string {
-	curNode := mpt.db[hash]
-	delete(mpt.db, hash)
+	curNode := mpt.get_node(hash)
 	var node_hash string //hash value of current node
 
 	if len(hex_array) == 0 { //insert value
-		curNode.branch_value[16] = new_value
+		curNode.branch_value[16] = wrap_branch_value(new_value)
 	} else {
 		//branch-2
 		next_node_hash := curNode.branch_value[hex_array[0]]
@@ -385,7 +458,7 @@ func (mpt *MerklePatriciaTrie) branch_insert_helper(hex_array []uint8, new_value
 		}
 	}
 	//store in the map
-	mpt.db[curNode.hash_node()] = curNode
+	mpt.db.Put(curNode.hash_node(), curNode)
 	//return the hash value of current node
 	node_hash = curNode.hash_node()
 	return node_hash
@@ -398,7 +471,7 @@ Arguments: hex_array(array of u8), new_value(string), hash(string)
 Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) extension_insert_helper(hex_array []uint8, new_value string, hash string) string {
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	var node_hash string                               //hash value of current node
 	encodedPrefix := curNode.flag_value.encoded_prefix //[17,97]
 	decode_array := compact_decode(encodedPrefix)      //[1,6,1]
@@ -409,7 +482,7 @@ func (mpt *MerklePatriciaTrie) extension_insert_helper(hex_array []uint8, new_va
 			//create branch
 			branch_value := [17]string{}
 			branch_value[decode_array[0]] = curNode.flag_value.value
-			branch_value[16] = new_value
+			branch_value[16] = wrap_branch_value(new_value)
 			node_hash = mpt.create_branch_node(branch_value)
 		} else { //len(decode_array) > 1
 			//create extension
@@ -417,7 +490,7 @@ func (mpt *MerklePatriciaTrie) extension_insert_helper(hex_array []uint8, new_va
 			//create branch
 			branch_value := [17]string{}
 			branch_value[decode_array[0]] = ext
-			branch_value[16] = new_value
+			branch_value[16] = wrap_branch_value(new_value)
 			node_hash = mpt.create_branch_node(branch_value)
 		}
 	} else if commonLen == 0 { //2. hex_array=[6,2] decode_array=[7,8,9]
@@ -444,7 +517,7 @@ func (mpt *MerklePatriciaTrie) extension_insert_helper(hex_array []uint8, new_va
 		//find next node
 		update_hash := mpt.insert_helper(hex_array[commonLen:], new_value, curNode.flag_value.value)
 		curNode.flag_value.value = update_hash
-		mpt.db[curNode.hash_node()] = curNode
+		mpt.db.Put(curNode.hash_node(), curNode)
 		node_hash = curNode.hash_node()
 	} else { //4.commonLen < len(decode_array)
 		if commonLen == len(hex_array) { //4.1
@@ -454,15 +527,15 @@ func (mpt *MerklePatriciaTrie) extension_insert_helper(hex_array []uint8, new_va
 				//create branch
 				branch_value := [17]string{}
 				branch_value[decode_array[commonLen]] = ext2
-				branch_value[16] = new_value
+				branch_value[16] = wrap_branch_value(new_value)
 				branch := mpt.create_branch_node(branch_value)
 				//create ext1
 				node_hash = mpt.create_extension_node(decode_array[:commonLen], branch)
 			} else { //4.1.2 commonLen = len(decode_array) - 1
 				//create branch
 				branch_value := [17]string{}
-				branch_value[decode_array[0]] = curNode.flag_value.value
-				branch_value[16] = new_value
+				branch_value[decode_array[commonLen]] = curNode.flag_value.value
+				branch_value[16] = wrap_branch_value(new_value)
 				branch := mpt.create_branch_node(branch_value)
 				//create ext
 				node_hash = mpt.create_extension_node(decode_array[:commonLen], branch)
@@ -504,8 +577,7 @@ Arguments: hex_array(array of u8), new_value(string), hash(string)
 Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) leaf_insert_helper(hex_array []uint8, new_value string, hash string) string {
-	curNode := mpt.db[hash]
-	delete(mpt.db, hash)
+	curNode := mpt.get_node(hash)
 	var node_hash string                               //hash value of current node
 	encodedPrefix := curNode.flag_value.encoded_prefix //[17,97]
 	decode_array := compact_decode(encodedPrefix)      //[1,6,1]
@@ -513,9 +585,8 @@ func (mpt *MerklePatriciaTrie) leaf_insert_helper(hex_array []uint8, new_value s
 	//prefix := encodedPrefix[0]/16
 	if commonLen == len(hex_array) && commonLen == len(decode_array) { //1. totally match
 		curNode.flag_value.value = new_value //update value
-		mpt.db[curNode.hash_node()] = curNode
+		mpt.db.Put(curNode.hash_node(), curNode)
 		node_hash = curNode.hash_node()
-		//since we update the value of the node, delete the old one
 	} else if commonLen == 0 { //2. totally un match
 		if len(decode_array) == 0 {
 			//create leaf
@@ -523,7 +594,7 @@ func (mpt *MerklePatriciaTrie) leaf_insert_helper(hex_array []uint8, new_value s
 			//create branch
 			branch_value := [17]string{}
 			branch_value[hex_array[0]] = leaf
-			branch_value[16] = curNode.flag_value.value
+			branch_value[16] = wrap_branch_value(curNode.flag_value.value)
 			node_hash = mpt.create_branch_node(branch_value)
 		} else if len(hex_array) == 0 {
 			//create leaf
@@ -531,10 +602,8 @@ func (mpt *MerklePatriciaTrie) leaf_insert_helper(hex_array []uint8, new_value s
 			//create branch
 			branch_value := [17]string{}
 			branch_value[decode_array[0]] = leaf
-			branch_value[16] = new_value
+			branch_value[16] = wrap_branch_value(new_value)
 			node_hash = mpt.create_branch_node(branch_value)
-			//since the new leaf node has same value, the hash value store in db will be same.
-			//we don't have to delete the old one
 		} else { //2.3hex=[1,2] cur=[3,4]
 			//create leaf1
 			leaf1 := mpt.create_leaf_node(hex_array[1:], new_value)
@@ -552,22 +621,22 @@ func (mpt *MerklePatriciaTrie) leaf_insert_helper(hex_array []uint8, new_value s
 		//create branch node
 		branch_value := [17]string{}
 		branch_value[hex_array[commonLen]] = leaf
-		branch_value[16] = curNode.flag_value.value
+		branch_value[16] = wrap_branch_value(curNode.flag_value.value)
 		branch := mpt.create_branch_node(branch_value)
 		//create extension node
 		node_hash = mpt.create_extension_node(hex_array[:commonLen], branch)
 
 	} else if commonLen == len(hex_array) { //4
 		//create leaf
-		leaf := mpt.create_leaf_node(decode_array[commonLen+2:], curNode.flag_value.value)
+		leaf := mpt.create_leaf_node(decode_array[commonLen+1:], curNode.flag_value.value)
 		branch_value := [17]string{}
 		//create leaf node
 		branch_value[decode_array[commonLen]] = leaf
-		branch_value[16] = new_value
+		branch_value[16] = wrap_branch_value(new_value)
 		//create branch
 		branch := mpt.create_branch_node(branch_value)
 		//create extension
-		node_hash = mpt.create_extension_node(hex_array[:commonLen-1], branch)
+		node_hash = mpt.create_extension_node(hex_array[:commonLen], branch)
 	} else if commonLen <= len(hex_array) && commonLen <= len(decode_array) { //5
 		//ok
 		//create leaf1
@@ -596,7 +665,7 @@ func (mpt *MerklePatriciaTrie) create_leaf_node(hex_array []uint8, new_value str
 	hex_array = append(hex_array, 16)
 	flag_value := Flag_value{compact_encode(hex_array), new_value}
 	leaf_node := Node{2, [17]string{}, flag_value}
-	mpt.db[leaf_node.hash_node()] = leaf_node
+	mpt.db.Put(leaf_node.hash_node(), leaf_node)
 	return leaf_node.hash_node()
 }
 
@@ -609,7 +678,7 @@ return:hash value of branch node (string)
 func (mpt *MerklePatriciaTrie) create_branch_node(branch_value [17]string) string {
 
 	branch_node := Node{1, branch_value, Flag_value{}}
-	mpt.db[branch_node.hash_node()] = branch_node
+	mpt.db.Put(branch_node.hash_node(), branch_node)
 	return branch_node.hash_node()
 }
 
@@ -622,7 +691,7 @@ return:hash value of extension node (string)
 func (mpt *MerklePatriciaTrie) create_extension_node(hex_array []uint8, hash_value string) string {
 	flag_value := Flag_value{compact_encode(hex_array), hash_value}
 	extention_node := Node{2, [17]string{}, flag_value}
-	mpt.db[extention_node.hash_node()] = extention_node
+	mpt.db.Put(extention_node.hash_node(), extention_node)
 	return extention_node.hash_node()
 }
 
@@ -634,7 +703,7 @@ Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) delete_helper(hex_array []uint8, hash string) string {
 	//var value string
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	//delete(mpt.db, hash)
 	var node_hash string //hash value of current node
 	switch curNode.node_type {
@@ -662,13 +731,11 @@ Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash string) string {
 	var node_hash string
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	if len(hex_array) == 0 { //1
 		if curNode.branch_value[16] == "" { //1.1
 			node_hash = "path_not_found"
 		} else { //1.2
-			//delete old branch node
-			delete(mpt.db, hash)
 			//update value
 			curNode.branch_value[16] = ""
 			sum := elements_sum(curNode.branch_value)
@@ -676,7 +743,7 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 				//next_hash := find_next_node(curNode.branch_value)
 				index := find_next_node(curNode.branch_value)
 				next_hash := curNode.branch_value[index]
-				next_node := mpt.db[next_hash]
+				next_node := mpt.get_node(next_hash)
 				if next_node.node_type == 1 { //1.2.1.3 Branch
 					//get new hex_array
 					arr := []uint8{uint8(index)}
@@ -685,8 +752,6 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 				} else { //next_node.node_type == 2
 					prefix := next_node.flag_value.encoded_prefix[0] / 16
 					if prefix == 2 || prefix == 3 { //1.2.1.1 Leaf Node
-						//delete leaf
-						delete(mpt.db, next_hash)
 						//combine arr
 						arr := []uint8{uint8(index)}
 						leaf_remain := compact_decode(next_node.flag_value.encoded_prefix)
@@ -694,8 +759,6 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 						//create leaf
 						node_hash = mpt.create_leaf_node(arr, next_node.flag_value.value)
 					} else { //1.2.1.2 Ext
-						//delete ext
-						delete(mpt.db, next_hash)
 						//combine arr
 						arr := []uint8{uint8(index)}
 						ext_remain := compact_decode(next_node.flag_value.encoded_prefix)
@@ -705,7 +768,7 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 					}
 				}
 			} else { //1.2.2 sum>1
-				mpt.db[curNode.hash_node()] = curNode
+				mpt.db.Put(curNode.hash_node(), curNode)
 				node_hash = curNode.hash_node()
 			}
 		}
@@ -717,20 +780,19 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 			if return_value == "path_not_found" { //2.2.1
 				node_hash = "path_not_found"
 			} else if return_value == "" { //2.2.2 already delete the next node, and nothing left
-				//remove branch node
-				delete(mpt.db, hash)
 				curNode.branch_value[hex_array[0]] = ""
 				if elements_sum(curNode.branch_value) > 1 { //2.2.2.1
-					mpt.db[curNode.hash_node()] = curNode
+					mpt.db.Put(curNode.hash_node(), curNode)
 					node_hash = curNode.hash_node()
 				} else { //2.2.2.2 elements_sum(curNode.branch_value) = 1
 					if curNode.branch_value[16] != "" { //2.2.2.2.1 not the value
 						//create leaf
-						node_hash = mpt.create_leaf_node([]uint8{}, curNode.branch_value[16])
+						value, _ := unwrap_branch_value(curNode.branch_value[16])
+						node_hash = mpt.create_leaf_node([]uint8{}, value)
 					} else { //2.2.2.2.2 b_v[0~15]
 						index := find_next_node(curNode.branch_value)
 						next_hash := curNode.branch_value[index]
-						next_node := mpt.db[next_hash]
+						next_node := mpt.get_node(next_hash)
 
 						if next_node.node_type == 1 { //Branch
 							//get hex_array
@@ -740,8 +802,6 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 						} else { //next_node.node_type == 2
 							prefix := next_node.flag_value.encoded_prefix[0] / 16
 							if prefix == 2 || prefix == 3 { //Leaf Node
-								//remove leaf
-								delete(mpt.db, next_hash)
 								//combine arr
 								arr := []uint8{uint8(index)}
 								leaf_remain := compact_decode(next_node.flag_value.encoded_prefix)
@@ -749,8 +809,6 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 								//create leaf
 								node_hash = mpt.create_leaf_node(arr, next_node.flag_value.value)
 							} else { // Ext
-								//delete ext
-								delete(mpt.db, next_hash)
 								//combine arr
 								arr := []uint8{uint8(index)}
 								ext_remain := compact_decode(next_node.flag_value.encoded_prefix)
@@ -762,9 +820,8 @@ func (mpt *MerklePatriciaTrie) branch_delete_helper(hex_array []uint8, hash stri
 					}
 				}
 			} else { //2.2.3 hash
-				delete(mpt.db, hash)
 				curNode.branch_value[hex_array[0]] = return_value
-				mpt.db[curNode.hash_node()] = curNode
+				mpt.db.Put(curNode.hash_node(), curNode)
 				node_hash = curNode.hash_node()
 			}
 		}
@@ -781,7 +838,7 @@ Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) extension_delete_helper(hex_array []uint8, hash string) string {
 	var node_hash string
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	decode_array := compact_decode(curNode.flag_value.encoded_prefix) //[1,6,1]
 	commonLen := common_length(hex_array, decode_array)
 	if commonLen != len(decode_array) { //1
@@ -792,22 +849,17 @@ func (mpt *MerklePatriciaTrie) extension_delete_helper(hex_array []uint8, hash s
 		if retrun_value == "path_not_found" { //2.1
 			node_hash = "path_not_found"
 		} else { //2.3 retrun_value == hash
-			return_node := mpt.db[retrun_value]
+			return_node := mpt.get_node(retrun_value)
 
 			if return_node.node_type == 1 { //Branch
-				//delete old ext
-				delete(mpt.db, hash)
 				//update value
 				curNode.flag_value.value = retrun_value
 				//store in db
-				mpt.db[curNode.hash_node()] = curNode
+				mpt.db.Put(curNode.hash_node(), curNode)
 				node_hash = curNode.hash_node()
 			} else { //Ext or Leaf
 				prefix := return_node.flag_value.encoded_prefix[0] / 16
 				if prefix == 2 || prefix == 3 { //Leaf Node
-					//remove old ext, leaf
-					delete(mpt.db, hash)
-					delete(mpt.db, retrun_value)
 					//get remains
 					ext_remain := compact_decode(curNode.flag_value.encoded_prefix)
 					leaf_remain := compact_decode(return_node.flag_value.encoded_prefix)
@@ -818,9 +870,6 @@ func (mpt *MerklePatriciaTrie) extension_delete_helper(hex_array []uint8, hash s
 					//create leaf
 					node_hash = mpt.create_leaf_node(arr, return_node.flag_value.value)
 				} else { // Ext
-					//remove ext1, ext2
-					delete(mpt.db, hash)
-					delete(mpt.db, retrun_value)
 					//get remains
 					ext1_remain := compact_decode(curNode.flag_value.encoded_prefix)
 					ext2_remain := compact_decode(return_node.flag_value.encoded_prefix)
@@ -849,12 +898,10 @@ Return: the value stored for that key (string)
  */
 func (mpt *MerklePatriciaTrie) leaf_delete_helper(hex_array []uint8, hash string) string {
 	var value string
-	curNode := mpt.db[hash]
+	curNode := mpt.get_node(hash)
 	decode_array := compact_decode(curNode.flag_value.encoded_prefix) //[1,6,1]
 	commonLen := common_length(hex_array, decode_array)
 	if commonLen == len(hex_array) && commonLen == len(decode_array) { //1
-		//delete leaf node
-		delete(mpt.db, hash)
 		value = ""
 	} else { //2 hex != cur
 		value = "path_not_found"
@@ -902,22 +949,14 @@ Return: s(string)
 Example: hex_array=[6,1,6,2,6,3], string="abc"
  */
 func Hex_arrayToString(hex_array []uint8) string {
-	//key := Hex_arrayToString(hex_array)
+	//the empty key
+	if len(hex_array) == 0 {
+		return ""
+	}
 	dec_array := compact_encode(hex_array) //[0,97]
-	//???
 	if dec_array[0] == 0 {
 		dec_array = dec_array[1:]
 	}
-	//var str string
-	//for _,v := range hex_array{
-	//	str += string(strconv.Itoa(int(v))) //616263
-	//}
-	//fmt.Println(str)
-	//dec_array, err := hex.DecodeString(str) //[97 98 99]
-	//if err != nil {
-	//	panic(err)
-	//}
-	//
 	return string(dec_array)
 }
 
@@ -982,26 +1021,12 @@ func test_compact_encode() {
 
 /**
 Description: This function takes a node as the input, hash the node and return the hashed string.
+The hash is the SHA3-256 of the canonical binary encoding of the node (see encode_node),
+which includes the compact-encoded path of Ext and Leaf nodes.
  */
 func (node *Node) hash_node() string {
-	var str string
-	switch node.node_type {
-	case 0:
-		str = ""
-	case 1:
-		str = "branch_"
-		for _, v := range node.branch_value {
-			//connect all the elements in the array
-			str += v
-		}
-	case 2:
-		//leaf node: rlp value
-		//ext node: hash value of next node
-		//node.flag_value.prefix
-		str = node.flag_value.value
-	}
 	//encryption
-	sum := sha3.Sum256([]byte(str))
+	sum := sha3.Sum256(encode_node(*node))
 	return "HashStart_" + hex.EncodeToString(sum[:]) + "_HashEnd"
 }
 
@@ -1015,7 +1040,8 @@ func (node *Node) String() string {
 		for i, v := range node.branch_value[:16] {
 			str += fmt.Sprintf("%d=\"%s\", ", i, v)
 		}
-		str += fmt.Sprintf("value=%s]", node.branch_value[16])
+		value, _ := unwrap_branch_value(node.branch_value[16])
+		str += fmt.Sprintf("value=%s]", value)
 	case 2:
 		encoded_prefix := node.flag_value.encoded_prefix
 		node_name := "Leaf"
@@ -1032,8 +1058,54 @@ func node_to_string(node Node) string {
 	return node.String()
 }
 
+/**
+Description: Initialize an empty trie whose nodes are stored in memory.
+ */
 func (mpt *MerklePatriciaTrie) Initial() {
-	mpt.db = make(map[string]Node)
+	mpt.InitialWithStore(NewMemoryNodeStore())
+}
+
+/**
+Description: Initialize an empty trie whose nodes are stored in store.
+Arguments: store (NodeStore)
+ */
+func (mpt *MerklePatriciaTrie) InitialWithStore(store NodeStore) {
+	mpt.db = store
+	mpt.root = ""
+	mpt.fork = &mpt_fork{}
+	mpt.shared = &mpt_shared{id: atomic.AddUint64(&shared_ids, 1), forks: map[*mpt_fork]bool{mpt.fork: true}}
+}
+
+/**
+Description:
+Reopen a trie from its root hash. The nodes of the trie must be in store,
+for example in a FileNodeStore written by a previous process.
+Arguments: store (NodeStore), root (string)
+Return: the trie, *MissingNodeError if the root node is not in store.
+ */
+func OpenMpt(store NodeStore, root string) (MerklePatriciaTrie, error) {
+	mpt := MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	if root != "" {
+		if _, ok := store.Get(root); !ok {
+			return mpt, &MissingNodeError{root}
+		}
+	}
+	mpt.root = root
+	return mpt, nil
+}
+
+/**
+Description: Get a node from db. A missing node is returned as a Null node.
+Arguments: hash (string)
+Return: Node
+ */
+func (mpt *MerklePatriciaTrie) get_node(hash string) Node {
+	if mpt.db == nil || hash == "" {
+		return Node{}
+	}
+	node, _ := mpt.db.Get(hash)
+	return node
 }
 
 func is_ext_node(encoded_arr []uint8) bool {
@@ -1045,9 +1117,14 @@ func TestCompact() {
 }
 
 func (mpt *MerklePatriciaTrie) String() string {
+	mpt.read_lock()
+	defer mpt.read_unlock()
 	content := fmt.Sprintf("ROOT=%s\n", mpt.root)
-	for hash := range mpt.db {
-		content += fmt.Sprintf("%s: %s\n", hash, node_to_string(mpt.db[hash]))
+	if mpt.db == nil {
+		return content
+	}
+	for _, hash := range mpt.db.Hashes() {
+		content += fmt.Sprintf("%s: %s\n", hash, node_to_string(mpt.get_node(hash)))
 	}
 	return content
 }
@@ -1088,34 +1165,108 @@ func (mpt *MerklePatriciaTrie) Order_nodes() string {
 /**
 The size is the length of the byte array of the block value.
 You have a mpt as the block's value, you convert mpt to byte array, then size equals to the length of that byte array.
+The byte array only contains the nodes reachable from root, so it doesn't depend on the order of db
+or on the replaced nodes still in db. Format (RLP):
+[root hash (32 bytes, or empty), node_1, node_2, ...]
+The nodes are the canonical encodings (see encode_node), each one as an RLP string,
+in pre-order from the root, children of a branch in the order 0 to 15, every node only once.
+Use MptFromByteArray to decode it back into a trie.
  */
 func (mpt *MerklePatriciaTrie) MptToByteArray() []byte {
-	//1.
-	//l := unsafe.Sizeof(mpt)
-	//pb := (*[1024]byte)(unsafe.Pointer(&mpt))
-	//byteArray := (*pb)[:l]
-
-	//2.
-	byteArray := []byte(fmt.Sprintf("%v", mpt))
-	return byteArray
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	items := [][]byte{rlp_encode_bytes(hash_to_bytes(mpt.root))}
+	visited := make(map[string]bool)
+	items = mpt.serialize_helper(mpt.root, visited, items)
+	return rlp_encode_list(items)
+}
+
+/**
+Description: append the encoding of hash and of all the nodes below it to items, in pre-order.
+Arguments: hash(string), visited(map[string]bool), items([][]byte)
+Return: items([][]byte)
+ */
+func (mpt *MerklePatriciaTrie) serialize_helper(hash string, visited map[string]bool, items [][]byte) [][]byte {
+	if hash == "" || visited[hash] {
+		return items
+	}
+	visited[hash] = true
+	node := mpt.get_node(hash)
+	items = append(items, rlp_encode_bytes(encode_node(node)))
+	switch node.node_type {
+	case 1: //Branch
+		for _, child := range node.branch_value[:16] {
+			items = mpt.serialize_helper(child, visited, items)
+		}
+	case 2: //Ext or Leaf
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			items = mpt.serialize_helper(node.flag_value.value, visited, items)
+		}
+	}
+	return items
+}
+
+/**
+Description: Decode the byte array of MptToByteArray back into a trie, stored in memory.
+Every node is checked against its hash, and every node reachable from the root must be present.
+Arguments: data ([]byte)
+Return: MerklePatriciaTrie, error
+ */
+func MptFromByteArray(data []byte) (MerklePatriciaTrie, error) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	item, rest, err := rlp_decode(data)
+	if err != nil {
+		return mpt, err
+	}
+	if !item.is_list || len(item.items) == 0 || len(rest) != 0 {
+		return mpt, &CorruptNodeError{Reason: "bad trie encoding"}
+	}
+	root, err := bytes_to_hash(item.items[0].bytes)
+	if err != nil {
+		return mpt, err
+	}
+	for _, node_item := range item.items[1:] {
+		node, err := decode_node(node_item.bytes)
+		if err != nil {
+			return mpt, err
+		}
+		mpt.db.Put(node.hash_node(), node)
+	}
+	//every node used by the trie must be there
+	visited := make(map[string]bool)
+	if len(mpt.serialize_helper(root, visited, nil)) != len(item.items)-1 {
+		return mpt, &CorruptNodeError{Reason: "missing or extra nodes"}
+	}
+	for hash := range visited {
+		if _, ok := mpt.db.Get(hash); !ok {
+			return mpt, &MissingNodeError{hash}
+		}
+	}
+	mpt.root = root
+	return mpt, nil
 }
 
 /**
 Description:
-This function traverse the mpt and return a map of key and values
-Arguments: hash(string), previous（[]uint8）
-Return: map[string]string
+This function traverse the mpt and store all the key and values into pairs.
+The map is owned by the caller, so two traversals never share state.
+Arguments: hash(string), previous（[]uint8）, pairs(map[string]string)
  */
-func (mpt *MerklePatriciaTrie) tranverseMpt(hash string, previous []uint8) map[string]string {
+func (mpt *MerklePatriciaTrie) tranverseMpt(hash string, previous []uint8, pairs map[string]string) {
 
-	node := mpt.db[hash]
+	node := mpt.get_node(hash)
 	switch node.node_type {
 	case 1: //branch
-		for i, v := range node.branch_value {
+		for i, v := range node.branch_value[:16] {
 			if v != "" {
-				mpt.tranverseMpt(v, append(previous, uint8(i)))
+				mpt.tranverseMpt(v, append(previous, uint8(i)), pairs)
 			}
 		}
+		//the value of the key ending at this branch
+		if value, found := unwrap_branch_value(node.branch_value[16]); found {
+			pairs[Hex_arrayToString(previous)] = value
+		}
 	case 2: //leaf or ext
 		encodedPrefix := node.flag_value.encoded_prefix //[17,97]
 		prefix := encodedPrefix[0] / 16
@@ -1126,26 +1277,25 @@ func (mpt *MerklePatriciaTrie) tranverseMpt(hash string, previous []uint8) map[s
 			key := Hex_arrayToString(hex_array)
 			value := node.flag_value.value
 			//store key and value
-			mptMap[key] = value
+			pairs[key] = value
 		} else { // Ext
-			mpt.tranverseMpt(node.flag_value.value, append(previous, compact_decode(node.flag_value.encoded_prefix)...))
+			mpt.tranverseMpt(node.flag_value.value, append(previous, compact_decode(node.flag_value.encoded_prefix)...), pairs)
 		}
 	}
-	return  mptMap
 }
 
 /**
 Description:
-This function initialize the mptMap and call tranverseMpt method to get all the key and value pairs.
+This function creates a new map and call tranverseMpt method to get all the key and value pairs.
+Example:
+"a" -> "apple"
 Arguments: hash(string), previous（[]uint8）
 Return: map[string]string
  */
 func (mpt *MerklePatriciaTrie) GetMptMap(hash string, previous []uint8) map[string]string {
-	mptMap = make(map[string]string)
-	mpt.tranverseMpt(hash, previous)
-	return mptMap
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	pairs := make(map[string]string)
+	mpt.tranverseMpt(hash, append([]uint8{}, previous...), pairs)
+	return pairs
 }
-
-
-
-
@@ -0,0 +1,290 @@
+package p1
+
+import (
+	"sort"
+)
+
+/**
+KeyValuePair is a (key, value) pair of a trie.
+ */
+type KeyValuePair struct {
+	Key   string
+	Value string
+}
+
+/**
+Description:
+BuildFromSorted replaces the content of the trie with pairs, building every node once, bottom up.
+No intermediate node is created, unlike calling Insert for every key.
+The pairs must be sorted by key, without duplicates.
+Arguments: pairs ([]KeyValuePair)
+Return: *InvalidKeyError if the pairs are not sorted.
+ */
+func (mpt *MerklePatriciaTrie) BuildFromSorted(pairs []KeyValuePair) error {
+	for i := 1; i < len(pairs); i++ {
+		if pairs[i-1].Key >= pairs[i].Key {
+			return &InvalidKeyError{pairs[i].Key, "pairs not sorted"}
+		}
+	}
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	mpt.root = mpt.build_pairs(pairs)
+	return nil
+}
+
+/**
+Description:
+InsertBatch inserts many pairs at once. The pairs don't have to be sorted, if a key appears
+more than once, the last value wins. The sorted pairs are built into the subtrees they change,
+the other subtrees of the trie are kept as they are, so the cost depends on the pairs, not on the trie.
+Arguments: pairs ([]KeyValuePair)
+Return: error *MissingNodeError or *CorruptNodeError, the trie is not changed then
+ */
+func (mpt *MerklePatriciaTrie) InsertBatch(pairs []KeyValuePair) error {
+	merged := make(map[string]string)
+	for _, pair := range pairs {
+		merged[pair.Key] = pair.Value
+	}
+	sorted := make([]string, 0, len(merged))
+	for k := range merged {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	keys := make([][]uint8, len(sorted))
+	values := make([]string, len(sorted))
+	for i, k := range sorted {
+		keys[i] = stringToHex_array(k)
+		values[i] = merged[k]
+	}
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	root, err := mpt.merge_node(mpt.root, keys, values)
+	if err != nil {
+		return err
+	}
+	mpt.root = root
+	return nil
+}
+
+/**
+Description:
+The merge_node function inserts sorted, distinct hex arrays (relative to the node) in the subtree of hash.
+(1) no subtree: the keys are built with build_node
+(2) a leaf: its key is one more pair, the new value wins
+(3) an extension: see merge_extension
+(4) a branch: the keys are merged in the children of their first nibble
+Arguments: hash (string), keys ([][]uint8), values ([]string)
+Return: hash value of the new node (string), error *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) merge_node(hash string, keys [][]uint8, values []string) (string, error) {
+	if len(keys) == 0 {
+		return hash, nil
+	}
+	if hash == "" {
+		return mpt.build_node(keys, values), nil
+	}
+	node, ok := mpt.db.Get(hash)
+	if !ok {
+		return "", &MissingNodeError{hash}
+	}
+	switch node.node_type {
+	case 1: //Branch
+		branch_value := node.branch_value
+		if len(keys[0]) == 0 {
+			branch_value[16] = wrap_branch_value(values[0])
+			keys = keys[1:]
+			values = values[1:]
+		}
+		for start := 0; start < len(keys); {
+			nibble := keys[start][0]
+			end := start
+			var children [][]uint8
+			for end < len(keys) && keys[end][0] == nibble {
+				children = append(children, keys[end][1:])
+				end++
+			}
+			child, err := mpt.merge_node(branch_value[nibble], children, values[start:end])
+			if err != nil {
+				return "", err
+			}
+			branch_value[nibble] = child
+			start = end
+		}
+		return mpt.create_branch_node(branch_value), nil
+	case 2: //Ext or Leaf
+		if !valid_compact_prefix(node.flag_value.encoded_prefix) {
+			return "", &CorruptNodeError{Hash: hash, Reason: "bad compact prefix"}
+		}
+		path := compact_decode(node.flag_value.encoded_prefix)
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			return mpt.merge_extension(path, node.flag_value.value, keys, values)
+		}
+		//the leaf key is inserted in order, unless a new key replaces it
+		i := sort.Search(len(keys), func(i int) bool { return compare_hex_array(keys[i], path) >= 0 })
+		if i == len(keys) || compare_hex_array(keys[i], path) != 0 {
+			keys = append(keys[:i:i], append([][]uint8{path}, keys[i:]...)...)
+			values = append(values[:i:i], append([]string{node.flag_value.value}, values[i:]...)...)
+		}
+		return mpt.build_node(keys, values), nil
+	}
+	return "", &CorruptNodeError{Hash: hash, Reason: "unknown node type"}
+}
+
+/**
+Description:
+The merge_extension function inserts sorted, distinct hex arrays in an extension with path and child.
+If every key starts with path, the keys are merged in child. Otherwise a branch is created where the
+first key leaves path, the rest of the extension is one of its children.
+Arguments: path ([]uint8), child (string), keys ([][]uint8), values ([]string)
+Return: hash value of the new node (string), error *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) merge_extension(path []uint8, child string, keys [][]uint8, values []string) (string, error) {
+	if len(path) == 0 {
+		return mpt.merge_node(child, keys, values)
+	}
+	commonLen := len(path)
+	for _, key := range keys {
+		if length := common_length(path, key); length < commonLen {
+			commonLen = length
+		}
+	}
+	rest := make([][]uint8, len(keys))
+	for i, key := range keys {
+		rest[i] = key[commonLen:]
+	}
+	var node_hash string
+	if commonLen == len(path) {
+		merged, err := mpt.merge_node(child, rest, values)
+		if err != nil {
+			return "", err
+		}
+		node_hash = merged
+	} else {
+		branch_value := [17]string{}
+		if len(rest[0]) == 0 {
+			branch_value[16] = wrap_branch_value(values[0])
+			rest = rest[1:]
+			values = values[1:]
+		}
+		//the rest of the extension is below path[commonLen], with the keys of that nibble
+		nibble := path[commonLen]
+		var below [][]uint8
+		var below_values []string
+		for start := 0; start < len(rest); {
+			end := start
+			var children [][]uint8
+			for end < len(rest) && rest[end][0] == rest[start][0] {
+				children = append(children, rest[end][1:])
+				end++
+			}
+			if rest[start][0] == nibble {
+				below, below_values = children, values[start:end]
+			} else {
+				branch_value[rest[start][0]] = mpt.build_node(children, values[start:end])
+			}
+			start = end
+		}
+		existing, err := mpt.merge_extension(path[commonLen+1:], child, below, below_values)
+		if err != nil {
+			return "", err
+		}
+		branch_value[nibble] = existing
+		node_hash = mpt.create_branch_node(branch_value)
+	}
+	if commonLen == 0 {
+		return node_hash, nil
+	}
+	return mpt.create_extension_node(path[:commonLen], node_hash), nil
+}
+
+/**
+Description: Compare two hex arrays in the order of their keys.
+Arguments: a ([]uint8), b ([]uint8)
+Return: -1, 0 or 1
+ */
+func compare_hex_array(a []uint8, b []uint8) int {
+	length := common_length(a, b)
+	switch {
+	case length == len(a) && length == len(b):
+		return 0
+	case length == len(a):
+		return -1
+	case length == len(b):
+		return 1
+	case a[length] < b[length]:
+		return -1
+	}
+	return 1
+}
+
+/**
+Description: build the nodes of sorted pairs, the caller holds the write lock.
+Arguments: pairs ([]KeyValuePair)
+Return: hash value of the root node (string)
+ */
+func (mpt *MerklePatriciaTrie) build_pairs(pairs []KeyValuePair) string {
+	keys := make([][]uint8, len(pairs))
+	values := make([]string, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = stringToHex_array(pair.Key)
+		values[i] = pair.Value
+	}
+	return mpt.build_node(keys, values)
+}
+
+/**
+Description:
+The build_node function builds the subtree of sorted, distinct hex arrays.
+(1) one key: a leaf node
+(2) the keys share a prefix: an extension node with the prefix, and a branch node below it
+(3) otherwise: a branch node
+Arguments: keys ([][]uint8), values ([]string)
+Return: hash value of the node (string), "" if there are no keys.
+ */
+func (mpt *MerklePatriciaTrie) build_node(keys [][]uint8, values []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	if len(keys) == 1 {
+		return mpt.create_leaf_node(keys[0], values[0])
+	}
+	//the keys are sorted, so the common prefix of all keys is the one of the first and the last key
+	commonLen := common_length(keys[0], keys[len(keys)-1])
+	if commonLen == 0 {
+		return mpt.build_branch(keys, values)
+	}
+	rest := make([][]uint8, len(keys))
+	for i, key := range keys {
+		rest[i] = key[commonLen:]
+	}
+	branch := mpt.build_branch(rest, values)
+	return mpt.create_extension_node(keys[0][:commonLen], branch)
+}
+
+/**
+Description:
+The build_branch function builds a branch node for sorted, distinct hex arrays with no common prefix.
+An empty key (it is the first one) is the value of the branch.
+Arguments: keys ([][]uint8), values ([]string)
+Return: hash value of the branch node (string)
+ */
+func (mpt *MerklePatriciaTrie) build_branch(keys [][]uint8, values []string) string {
+	branch_value := [17]string{}
+	if len(keys[0]) == 0 {
+		branch_value[16] = wrap_branch_value(values[0])
+		keys = keys[1:]
+		values = values[1:]
+	}
+	for start := 0; start < len(keys); {
+		nibble := keys[start][0]
+		end := start
+		var children [][]uint8
+		for end < len(keys) && keys[end][0] == nibble {
+			children = append(children, keys[end][1:])
+			end++
+		}
+		branch_value[nibble] = mpt.build_node(children, values[start:end])
+		start = end
+	}
+	return mpt.create_branch_node(branch_value)
+}
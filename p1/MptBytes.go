@@ -0,0 +1,106 @@
+package p1
+
+/**
+Binary-safe API. Keys and values are arbitrary bytes: zero bytes, the empty key and the empty value are allowed.
+The string API (Get, Insert, Delete) is a wrapper of this API.
+An empty branch_value[16] means that no key ends at the branch, so the value of a branch is wrapped
+(see wrap_branch_value) to store the empty value. Leaf values are stored as they are.
+ */
+
+/**
+Description: Get the value of key.
+Arguments: key ([]byte)
+Return: the value ([]byte, empty but not nil for the empty value), error ErrPathNotFound, *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) GetBytes(key []byte) ([]byte, error) {
+	if mpt == nil {
+		return nil, ErrPathNotFound
+	}
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	value, err := mpt.get_helper(stringToHex_array(string(key)), mpt.root)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+/**
+Description: Insert a pair of <key, value>, the value of an existing key is replaced.
+Arguments: key ([]byte), value ([]byte)
+Return: error *MissingNodeError or *CorruptNodeError, the trie is not changed then
+ */
+func (mpt *MerklePatriciaTrie) InsertBytes(key []byte, value []byte) error {
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	return mpt.insert_key(stringToHex_array(string(key)), string(value))
+}
+
+/**
+Description: Delete key.
+Arguments: key ([]byte)
+Return: error ErrPathNotFound if the key doesn't exist, *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) DeleteBytes(key []byte) error {
+	if mpt == nil {
+		return ErrPathNotFound
+	}
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	_, err := mpt.delete_key(stringToHex_array(string(key)))
+	return err
+}
+
+/**
+Description: Insert the key hex_array, the caller holds the write lock.
+Arguments: hex_array ([]uint8), value (string)
+Return: error *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) insert_key(hex_array []uint8, value string) error {
+	//insert_helper reads the nodes of the path: find the broken ones before changing anything,
+	//a missing node would be taken for an empty subtree
+	if _, err := mpt.get_helper(hex_array, mpt.root); err != nil && err != ErrPathNotFound {
+		return err
+	}
+	mpt.root = mpt.insert_helper(hex_array, value, mpt.root)
+	return nil
+}
+
+/**
+Description: Delete the key hex_array, the caller holds the write lock.
+Arguments: hex_array ([]uint8)
+Return: the new root (string), error ErrPathNotFound, *MissingNodeError or *CorruptNodeError
+ */
+func (mpt *MerklePatriciaTrie) delete_key(hex_array []uint8) (string, error) {
+	//find the broken nodes on the path before changing anything
+	if _, err := mpt.get_helper(hex_array, mpt.root); err != nil {
+		return "", err
+	}
+	root := mpt.delete_helper(hex_array, mpt.root)
+	if root == "path_not_found" {
+		return "", ErrPathNotFound
+	}
+	mpt.root = root
+	return root, nil
+}
+
+/**
+Description: Wrap a value to store it in branch_value[16], so the empty value is not an empty string.
+Arguments: value (string)
+Return: string
+ */
+func wrap_branch_value(value string) string {
+	return "v" + value
+}
+
+/**
+Description: Unwrap branch_value[16].
+Arguments: stored (string)
+Return: the value (string), false if no key ends at the branch.
+ */
+func unwrap_branch_value(stored string) (string, bool) {
+	if stored == "" {
+		return "", false
+	}
+	return stored[1:], true
+}
@@ -0,0 +1,191 @@
+package p1
+
+import "errors"
+
+/**
+ChangeType is the kind of a TrieChange.
+ChangeAdded: the key is only in the new trie.
+ChangeRemoved: the key is only in the old trie.
+ChangeModified: the key is in both tries, with different values.
+ */
+type ChangeType int
+
+const (
+	ChangeAdded ChangeType = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+/**
+TrieChange is one entry of a diff between two tries.
+OldValue is empty for ChangeAdded, NewValue is empty for ChangeRemoved.
+ */
+type TrieChange struct {
+	Key      string
+	OldValue string
+	NewValue string
+	Type     ChangeType
+}
+
+/**
+diff_position is a position in a trie: a node, and the number of nibbles of its path already walked.
+Inside an ext or leaf node, the position has a single child (the next nibble of the path),
+so the two tries can be walked nibble by nibble even if their nodes are split differently.
+ */
+type diff_position struct {
+	hash string
+	skip int
+}
+
+/**
+Description:
+Diff computes the changes between two roots of the trie's db, for example two committed versions.
+The subtrees with the same hash on both sides are skipped.
+The changes are sorted by key.
+Arguments: old_root (string), new_root (string)
+Return: []TrieChange, *MissingNodeError if a node is not in db
+ */
+func (mpt *MerklePatriciaTrie) Diff(old_root string, new_root string) ([]TrieChange, error) {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	for _, root := range []string{old_root, new_root} {
+		if root != "" && mpt.get_node(root).node_type == 0 {
+			return nil, &MissingNodeError{root}
+		}
+	}
+	var changes []TrieChange
+	err := diff_helper(mpt, diff_position{old_root, 0}, mpt, diff_position{new_root, 0}, []uint8{}, &changes)
+	return changes, err
+}
+
+/**
+Description:
+DiffMpt computes the changes that turn old_mpt into new_mpt, the two tries can use different stores.
+Applying the changes to old_mpt gives the content of new_mpt.
+Arguments: old_mpt (*MerklePatriciaTrie), new_mpt (*MerklePatriciaTrie)
+Return: []TrieChange, error
+ */
+func DiffMpt(old_mpt *MerklePatriciaTrie, new_mpt *MerklePatriciaTrie) ([]TrieChange, error) {
+	unlock := read_lock_pair(old_mpt, new_mpt)
+	defer unlock()
+	var changes []TrieChange
+	err := diff_helper(old_mpt, diff_position{old_mpt.root, 0}, new_mpt, diff_position{new_mpt.root, 0}, []uint8{}, &changes)
+	return changes, err
+}
+
+/**
+Description:
+ApplyChanges applies a change list to the trie: added and modified keys are inserted with their new value,
+removed keys are deleted. A removed key that is not in the trie is ignored.
+Arguments: changes ([]TrieChange)
+Return: error if a change has an unknown type, *MissingNodeError or *CorruptNodeError if a node is broken.
+No change is applied if there is an error.
+ */
+func (mpt *MerklePatriciaTrie) ApplyChanges(changes []TrieChange) error {
+	for _, change := range changes {
+		if change.Type != ChangeAdded && change.Type != ChangeRemoved && change.Type != ChangeModified {
+			return errors.New("invalid_change_type")
+		}
+	}
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	root := mpt.root
+	for _, change := range changes {
+		hex_array := stringToHex_array(change.Key)
+		var err error
+		if change.Type == ChangeRemoved {
+			_, err = mpt.delete_key(hex_array)
+			if err == ErrPathNotFound {
+				err = nil
+			}
+		} else {
+			err = mpt.insert_key(hex_array, change.NewValue)
+		}
+		if err != nil {
+			//the nodes are never changed in place, the old root is the trie before the changes
+			mpt.root = root
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Description:
+The diff_helper function compares two positions at the same path, and appends the changes below them.
+Arguments: old_mpt, old_pos, new_mpt, new_pos, path ([]uint8), changes (*[]TrieChange)
+Return: *MissingNodeError if a node is not in db
+ */
+func diff_helper(old_mpt *MerklePatriciaTrie, old_pos diff_position,
+	new_mpt *MerklePatriciaTrie, new_pos diff_position, path []uint8, changes *[]TrieChange) error {
+	//same node, same subtree
+	if old_pos == new_pos {
+		return nil
+	}
+	old_value, old_found, old_children, err := old_mpt.expand_position(old_pos)
+	if err != nil {
+		return err
+	}
+	new_value, new_found, new_children, err := new_mpt.expand_position(new_pos)
+	if err != nil {
+		return err
+	}
+	if old_found || new_found {
+		change := TrieChange{Key: Hex_arrayToString(path), OldValue: old_value, NewValue: new_value}
+		switch {
+		case !old_found:
+			change.Type = ChangeAdded
+			*changes = append(*changes, change)
+		case !new_found:
+			change.Type = ChangeRemoved
+			*changes = append(*changes, change)
+		case old_value != new_value:
+			change.Type = ChangeModified
+			*changes = append(*changes, change)
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if old_children[i].hash == "" && new_children[i].hash == "" {
+			continue
+		}
+		child_path := append(append([]uint8{}, path...), uint8(i))
+		if err := diff_helper(old_mpt, old_children[i], new_mpt, new_children[i], child_path, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Description:
+The expand_position function returns the value stored at a position and its 16 child positions.
+An extension node whose path is fully walked is replaced by its next node.
+Arguments: pos (diff_position)
+Return: value (string), found (bool), children ([16]diff_position), error
+ */
+func (mpt *MerklePatriciaTrie) expand_position(pos diff_position) (string, bool, [16]diff_position, error) {
+	children := [16]diff_position{}
+	if pos.hash == "" {
+		return "", false, children, nil
+	}
+	node := mpt.get_node(pos.hash)
+	switch node.node_type {
+	case 1: //Branch
+		for i, v := range node.branch_value[:16] {
+			children[i] = diff_position{v, 0}
+		}
+		value, found := unwrap_branch_value(node.branch_value[16])
+		return value, found, children, nil
+	case 2: //Ext or Leaf
+		path := compact_decode(node.flag_value.encoded_prefix)
+		if pos.skip < len(path) {
+			children[path[pos.skip]] = diff_position{pos.hash, pos.skip + 1}
+			return "", false, children, nil
+		}
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			return mpt.expand_position(diff_position{node.flag_value.value, 0})
+		}
+		return node.flag_value.value, true, children, nil
+	}
+	return "", false, children, &MissingNodeError{pos.hash}
+}
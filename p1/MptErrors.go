@@ -0,0 +1,54 @@
+package p1
+
+import (
+	"errors"
+)
+
+/**
+Errors of the trie operations. Use errors.Is(err, ErrPathNotFound) for an absent key,
+and errors.As with *MissingNodeError or *CorruptNodeError for a broken database.
+ */
+
+/**
+ErrPathNotFound: the key is not in the trie.
+ */
+var ErrPathNotFound = errors.New("path_not_found")
+
+/**
+MissingNodeError: a node used by the trie is not in db.
+ */
+type MissingNodeError struct {
+	Hash string
+}
+
+func (err *MissingNodeError) Error() string {
+	return "missing_node: " + err.Hash
+}
+
+/**
+CorruptNodeError: a node can't be decoded, or its content doesn't match its hash.
+Hash is empty if the hash of the node is unknown.
+ */
+type CorruptNodeError struct {
+	Hash   string
+	Reason string
+}
+
+func (err *CorruptNodeError) Error() string {
+	if err.Hash == "" {
+		return "corrupt_node: " + err.Reason
+	}
+	return "corrupt_node: " + err.Reason + " " + err.Hash
+}
+
+/**
+InvalidKeyError: a key can't be used by the operation, like an unsorted key in BuildFromSorted.
+ */
+type InvalidKeyError struct {
+	Key    string
+	Reason string
+}
+
+func (err *InvalidKeyError) Error() string {
+	return "invalid_key: " + err.Reason
+}
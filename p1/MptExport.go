@@ -0,0 +1,173 @@
+package p1
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+mpt_json is the node-level JSON format of a trie: the root, and the nodes reachable from it in pre-order.
+The nodes use the format of FileNodeStore (node_json), so an import gives the same root and the same nodes.
+ */
+type mpt_json struct {
+	Root  string          `json:"root"`
+	Nodes []mpt_node_json `json:"nodes"`
+}
+
+type mpt_node_json struct {
+	Hash string    `json:"hash"`
+	Node node_json `json:"node"`
+}
+
+/**
+Description: Encode the nodes of the trie into a JSON string. Nodes that are not reachable from root are not exported.
+Return: string, error
+ */
+func (mpt *MerklePatriciaTrie) EncodeToJson() (string, error) {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	export := mpt_json{Root: mpt.root, Nodes: []mpt_node_json{}}
+	for _, hash := range mpt.collect_nodes(mpt.root, make(map[string]bool), nil) {
+		export.Nodes = append(export.Nodes, mpt_node_json{hash, node_to_json(mpt.get_node(hash))})
+	}
+	jsonBytes, err := json.Marshal(export)
+	return string(jsonBytes), err
+}
+
+/**
+Description:
+Decode a trie from the JSON string of EncodeToJson, into a new in-memory trie.
+Every node hash is recomputed, and every node used by the trie must be there.
+Arguments: jsonString (string)
+Return: MerklePatriciaTrie, error
+ */
+func DecodeMptFromJson(jsonString string) (MerklePatriciaTrie, error) {
+	mpt := MerklePatriciaTrie{}
+	mpt.Initial()
+	export := mpt_json{}
+	if err := json.Unmarshal([]byte(jsonString), &export); err != nil {
+		return mpt, err
+	}
+	for _, nj := range export.Nodes {
+		node, err := json_to_node(nj.Node)
+		if err != nil {
+			return mpt, err
+		}
+		if node.hash_node() != nj.Hash {
+			return mpt, &CorruptNodeError{Hash: nj.Hash, Reason: "wrong hash"}
+		}
+		mpt.db.Put(nj.Hash, node)
+	}
+	hashes := mpt.collect_nodes(export.Root, make(map[string]bool), nil)
+	for _, hash := range hashes {
+		if _, ok := mpt.db.Get(hash); !ok {
+			return mpt, &MissingNodeError{hash}
+		}
+	}
+	if len(hashes) != len(mpt.db.Hashes()) {
+		return mpt, &CorruptNodeError{Reason: "extra nodes"}
+	}
+	mpt.root = export.Root
+	return mpt, nil
+}
+
+/**
+Description:
+Export the trie as a Graphviz DOT graph. Every node shows its type, its nibble path (ext and leaf),
+its value and its short hash. The edges of a branch are labelled with their nibble.
+Example: dot -Tpng mpt.dot -o mpt.png
+Return: string
+ */
+func (mpt *MerklePatriciaTrie) ToDot() string {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	var dot strings.Builder
+	dot.WriteString("digraph mpt {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, hash := range mpt.collect_nodes(mpt.root, make(map[string]bool), nil) {
+		node := mpt.get_node(hash)
+		var label string
+		switch node.node_type {
+		case 1: //Branch
+			label = "Branch"
+			if value, found := unwrap_branch_value(node.branch_value[16]); found {
+				label += "\\nvalue=" + dot_escape(strconv.Quote(value))
+			}
+			for i, child := range node.branch_value[:16] {
+				if child != "" {
+					dot.WriteString(fmt.Sprintf("\t%q -> %q [label=\"%x\"];\n", short_hash(hash), short_hash(child), i))
+				}
+			}
+		case 2: //Ext or Leaf
+			path := nibbles_to_string(compact_decode(node.flag_value.encoded_prefix))
+			if is_ext_node(node.flag_value.encoded_prefix) {
+				label = "Ext path=" + path
+				dot.WriteString(fmt.Sprintf("\t%q -> %q;\n", short_hash(hash), short_hash(node.flag_value.value)))
+			} else {
+				label = "Leaf path=" + path + "\\nvalue=" + dot_escape(strconv.Quote(node.flag_value.value))
+			}
+		default:
+			label = "Missing"
+		}
+		dot.WriteString(fmt.Sprintf("\t%q [label=\"%s\\n%s\"];\n", short_hash(hash), label, short_hash(hash)))
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+/**
+Description: The hashes of the nodes reachable from hash, in pre-order. A node used twice is listed once.
+Arguments: hash (string), visited (map[string]bool), hashes ([]string)
+Return: []string
+ */
+func (mpt *MerklePatriciaTrie) collect_nodes(hash string, visited map[string]bool, hashes []string) []string {
+	if hash == "" || visited[hash] {
+		return hashes
+	}
+	visited[hash] = true
+	hashes = append(hashes, hash)
+	node := mpt.get_node(hash)
+	switch node.node_type {
+	case 1: //Branch
+		for _, child := range node.branch_value[:16] {
+			hashes = mpt.collect_nodes(child, visited, hashes)
+		}
+	case 2: //Ext or Leaf
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			hashes = mpt.collect_nodes(node.flag_value.value, visited, hashes)
+		}
+	}
+	return hashes
+}
+
+/**
+Description: The first 8 hex digits of a node hash.
+Arguments: hash (string)
+Return: string
+ */
+func short_hash(hash string) string {
+	raw := hex.EncodeToString(hash_to_bytes(hash))
+	if len(raw) > 8 {
+		return raw[:8]
+	}
+	return raw
+}
+
+/**
+Description: Write nibbles as hex digits, [6,1,6] -> "616".
+Arguments: hex_array ([]uint8)
+Return: string
+ */
+func nibbles_to_string(hex_array []uint8) string {
+	var str strings.Builder
+	for _, nibble := range hex_array {
+		str.WriteString(strconv.FormatUint(uint64(nibble), 16))
+	}
+	return str.String()
+}
+
+func dot_escape(str string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(str)
+}
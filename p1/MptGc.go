@@ -0,0 +1,136 @@
+package p1
+
+/**
+GcReport is the result of a garbage collection run.
+(1) NodesReclaimed: the number of nodes deleted from db
+(2) BytesReclaimed: the size of those nodes
+(3) NodesLive: the number of nodes left in db
+(4) Err: the error of the flush of db (see Flusher), nil if the collection is durable
+ */
+type GcReport struct {
+	NodesReclaimed int
+	BytesReclaimed int
+	NodesLive      int
+	Err            error
+}
+
+/**
+Description:
+CollectGarbage deletes every node of db that can't be reached from a live root (mark and sweep).
+The live roots are the current root, the roots and the committed versions of the forks (see Clone),
+the open sessions and extra_roots.
+A copy made by assignment (b := mpt) shares the fork of the trie, and only the last root written
+by one of the copies is live: pass the roots of the other copies in extra_roots, or make them with Clone().
+Arguments: extra_roots (...string)
+Return: GcReport
+ */
+func (mpt *MerklePatriciaTrie) CollectGarbage(extra_roots ...string) GcReport {
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	return mpt.collect_garbage(extra_roots)
+}
+
+/**
+Description:
+Prune keeps only the last keep committed versions of the fork of the trie, and collects the nodes
+that are not used anymore. The versions of the other forks are kept.
+Arguments: keep (int), extra_roots (...string)
+Return: GcReport
+ */
+func (mpt *MerklePatriciaTrie) Prune(keep int, extra_roots ...string) GcReport {
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	if mpt.fork != nil && keep >= 0 && len(mpt.fork.versions) > keep {
+		versions := mpt.fork.versions
+		mpt.fork.versions = append([]string{}, versions[len(versions)-keep:]...)
+	}
+	return mpt.collect_garbage(extra_roots)
+}
+
+/**
+Description: The caller holds the write lock.
+Arguments: extra_roots ([]string)
+Return: GcReport
+ */
+func (mpt *MerklePatriciaTrie) collect_garbage(extra_roots []string) GcReport {
+	report := GcReport{}
+	if mpt.db == nil {
+		return report
+	}
+	//1.mark
+	live := mpt.live_nodes(extra_roots)
+	//2.sweep
+	for _, hash := range mpt.db.Hashes() {
+		if live[hash] {
+			report.NodesLive++
+			continue
+		}
+		node, _ := mpt.db.Get(hash)
+		report.NodesReclaimed++
+		report.BytesReclaimed += node_size(node)
+		mpt.db.Delete(hash)
+	}
+	if store, ok := mpt.db.(Flusher); ok {
+		report.Err = store.Flush()
+	}
+	return report
+}
+
+/**
+Description: The nodes reachable from the current root, the forks, the open sessions and extra_roots.
+Arguments: extra_roots ([]string)
+Return: map[string]bool
+ */
+func (mpt *MerklePatriciaTrie) live_nodes(extra_roots []string) map[string]bool {
+	live := make(map[string]bool)
+	roots := append([]string{mpt.root}, extra_roots...)
+	if mpt.shared != nil {
+		mpt.shared.forks_lock.Lock()
+		for fork := range mpt.shared.forks {
+			roots = append(roots, fork.root)
+			roots = append(roots, fork.versions...)
+		}
+		mpt.shared.forks_lock.Unlock()
+		for session := range mpt.shared.sessions {
+			roots = append(roots, session.trie.root)
+		}
+	}
+	for _, root := range roots {
+		mpt.mark_nodes(root, live)
+	}
+	return live
+}
+
+/**
+Description: mark hash and all the nodes below it as live.
+Arguments: hash (string), live (map[string]bool)
+ */
+func (mpt *MerklePatriciaTrie) mark_nodes(hash string, live map[string]bool) {
+	if hash == "" || live[hash] {
+		return
+	}
+	node, ok := mpt.db.Get(hash)
+	if !ok {
+		return
+	}
+	live[hash] = true
+	switch node.node_type {
+	case 1: //Branch
+		for _, child := range node.branch_value[:16] {
+			mpt.mark_nodes(child, live)
+		}
+	case 2: //Ext or Leaf
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			mpt.mark_nodes(node.flag_value.value, live)
+		}
+	}
+}
+
+/**
+Description: the size of a node is the length of its canonical binary encoding.
+Arguments: node (Node)
+Return: int
+ */
+func node_size(node Node) int {
+	return len(encode_node(node))
+}
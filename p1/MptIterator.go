@@ -0,0 +1,248 @@
+package p1
+
+/**
+MptIterator walks the (key, value) pairs of a MerklePatriciaTrie in lexicographic nibble order.
+It doesn't load the whole trie: every call of Next() walks down from the root to the next key,
+so the iterator only keeps the current key.
+Example:
+it := mpt.NewIterator("user:", false)
+for it.Next() {
+	fmt.Println(it.Key(), it.Value())
+}
+ */
+type MptIterator struct {
+	mpt     *MerklePatriciaTrie
+	prefix  []uint8 //only keys starting with prefix are returned
+	reverse bool
+	target  []uint8 //bound of the next search
+	strict  bool    //whether the key equal to target is skipped
+	done    bool
+	key     []uint8
+	value   string
+}
+
+/**
+Description:
+Create an iterator over all the keys starting with prefix.
+An empty prefix iterates over the whole trie.
+Arguments: prefix (string), reverse (bool) -- false: ascending order, true: descending order
+Return: *MptIterator
+ */
+func (mpt *MerklePatriciaTrie) NewIterator(prefix string, reverse bool) *MptIterator {
+	it := &MptIterator{mpt: mpt, prefix: stringToHex_array(prefix), reverse: reverse}
+	it.target = it.first_target()
+	return it
+}
+
+/**
+Description:
+Seek moves the iterator so that the following Next() returns the first key >= key,
+or the last key <= key for a reverse iterator. Keys outside the prefix are never returned.
+Arguments: key (string)
+ */
+func (it *MptIterator) Seek(key string) {
+	hex_array := stringToHex_array(key)
+	it.target = hex_array
+	it.strict = false
+	it.done = false
+	//don't start outside of the prefix
+	first := it.first_target()
+	if !it.reverse && compare_hex(hex_array, first) < 0 {
+		it.target = first
+	}
+	if it.reverse && compare_hex(hex_array, first) > 0 {
+		it.target = first
+	}
+}
+
+/**
+Description:
+Next moves the iterator to the next pair.
+Return: false if there are no more pairs.
+ */
+func (it *MptIterator) Next() bool {
+	if it.done || it.mpt == nil {
+		it.done = true
+		return false
+	}
+	it.mpt.read_lock()
+	defer it.mpt.read_unlock()
+	var key []uint8
+	var value string
+	var found bool
+	if it.reverse {
+		key, value, found = it.mpt.find_last(it.mpt.root, []uint8{}, it.target, it.strict)
+	} else {
+		key, value, found = it.mpt.find_first(it.mpt.root, []uint8{}, it.target, it.strict)
+	}
+	if !found || common_length(key, it.prefix) != len(it.prefix) {
+		it.done = true
+		it.key = nil
+		it.value = ""
+		return false
+	}
+	it.key = key
+	it.value = value
+	it.target = key
+	it.strict = true
+	return true
+}
+
+/**
+Return: the key of the current pair (string).
+ */
+func (it *MptIterator) Key() string {
+	if len(it.key) == 0 {
+		return ""
+	}
+	return Hex_arrayToString(it.key)
+}
+
+/**
+Return: the value of the current pair (string).
+ */
+func (it *MptIterator) Value() string {
+	return it.value
+}
+
+/**
+Description:
+The bound where the iteration starts: the prefix itself, or for a reverse iterator,
+the prefix followed by 16 which is greater than every key starting with prefix.
+Return: hex_array(array of u8)
+ */
+func (it *MptIterator) first_target() []uint8 {
+	target := append([]uint8{}, it.prefix...)
+	if it.reverse {
+		target = append(target, 16)
+	}
+	return target
+}
+
+/**
+Description:
+The find_first function finds the smallest key >= target (> target if strict) in the subtree of hash.
+Arguments: hash(string), path(array of u8) -- the nibbles before the node, target(array of u8), strict(bool)
+Return: key(array of u8), value(string), found(bool)
+ */
+func (mpt *MerklePatriciaTrie) find_first(hash string, path []uint8, target []uint8, strict bool) ([]uint8, string, bool) {
+	if compare_prefix(path, target) < 0 {
+		//every key in this subtree is smaller than target
+		return nil, "", false
+	}
+	curNode := mpt.get_node(hash)
+	switch curNode.node_type {
+	case 1: //Branch
+		value, found := unwrap_branch_value(curNode.branch_value[16])
+		if found && key_after(path, target, strict) {
+			return path, value, true
+		}
+		for i := 0; i < 16; i++ {
+			if curNode.branch_value[i] == "" {
+				continue
+			}
+			child_path := append(append([]uint8{}, path...), uint8(i))
+			if key, value, found := mpt.find_first(curNode.branch_value[i], child_path, target, strict); found {
+				return key, value, true
+			}
+		}
+	case 2: //Ext or Leaf
+		full_path := append(append([]uint8{}, path...), compact_decode(curNode.flag_value.encoded_prefix)...)
+		if is_ext_node(curNode.flag_value.encoded_prefix) {
+			return mpt.find_first(curNode.flag_value.value, full_path, target, strict)
+		}
+		if key_after(full_path, target, strict) {
+			return full_path, curNode.flag_value.value, true
+		}
+	}
+	return nil, "", false
+}
+
+/**
+Description:
+The find_last function finds the greatest key <= target (< target if strict) in the subtree of hash.
+Arguments: hash(string), path(array of u8) -- the nibbles before the node, target(array of u8), strict(bool)
+Return: key(array of u8), value(string), found(bool)
+ */
+func (mpt *MerklePatriciaTrie) find_last(hash string, path []uint8, target []uint8, strict bool) ([]uint8, string, bool) {
+	if compare_prefix(path, target) > 0 {
+		//every key in this subtree is greater than target
+		return nil, "", false
+	}
+	curNode := mpt.get_node(hash)
+	switch curNode.node_type {
+	case 1: //Branch
+		for i := 15; i >= 0; i-- {
+			if curNode.branch_value[i] == "" {
+				continue
+			}
+			child_path := append(append([]uint8{}, path...), uint8(i))
+			if key, value, found := mpt.find_last(curNode.branch_value[i], child_path, target, strict); found {
+				return key, value, true
+			}
+		}
+		value, found := unwrap_branch_value(curNode.branch_value[16])
+		if found && key_before(path, target, strict) {
+			return path, value, true
+		}
+	case 2: //Ext or Leaf
+		full_path := append(append([]uint8{}, path...), compact_decode(curNode.flag_value.encoded_prefix)...)
+		if is_ext_node(curNode.flag_value.encoded_prefix) {
+			return mpt.find_last(curNode.flag_value.value, full_path, target, strict)
+		}
+		if key_before(full_path, target, strict) {
+			return full_path, curNode.flag_value.value, true
+		}
+	}
+	return nil, "", false
+}
+
+/**
+Description:
+This function compares the keys of the subtree at path with target.
+Arguments: path(array of u8), target(array of u8)
+Return: -1 if every key starting with path is smaller than target,
+1 if every key starting with path is greater than target,
+0 if path is a prefix of target.
+ */
+func compare_prefix(path []uint8, target []uint8) int {
+	commonLen := common_length(path, target)
+	if commonLen == len(path) {
+		return 0
+	}
+	if commonLen == len(target) || path[commonLen] > target[commonLen] {
+		return 1
+	}
+	return -1
+}
+
+/**
+Description:
+This function compares two hex arrays in lexicographic order, a prefix is smaller than the longer array.
+Arguments: a(array of u8), b(array of u8)
+Return: -1, 0 or 1
+ */
+func compare_hex(a []uint8, b []uint8) int {
+	commonLen := common_length(a, b)
+	switch {
+	case commonLen == len(a) && commonLen == len(b):
+		return 0
+	case commonLen == len(a):
+		return -1
+	case commonLen == len(b):
+		return 1
+	case a[commonLen] < b[commonLen]:
+		return -1
+	}
+	return 1
+}
+
+func key_after(key []uint8, target []uint8, strict bool) bool {
+	c := compare_hex(key, target)
+	return c > 0 || (c == 0 && !strict)
+}
+
+func key_before(key []uint8, target []uint8, strict bool) bool {
+	c := compare_hex(key, target)
+	return c < 0 || (c == 0 && !strict)
+}
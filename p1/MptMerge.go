@@ -0,0 +1,103 @@
+package p1
+
+/**
+MergeResolver chooses the value of a key that has different values in the two tries of Merge.
+ */
+type MergeResolver func(key string, ours string, theirs string) string
+
+/**
+Description:
+Clone returns a copy of the trie in O(1). The copy shares db: nodes are never changed in place,
+so an Insert or Delete on one trie creates new nodes and doesn't change the other (copy on write).
+The copy is a new fork: it starts with the committed versions of the trie, then the two version lists
+are independent. The root and the versions of every fork are live for CollectGarbage and Prune
+until the fork is released, see Release().
+Return: MerklePatriciaTrie
+ */
+func (mpt *MerklePatriciaTrie) Clone() MerklePatriciaTrie {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	clone := MerklePatriciaTrie{db: mpt.db, root: mpt.root, shared: mpt.shared}
+	if mpt.shared == nil {
+		return clone
+	}
+	clone.fork = &mpt_fork{root: mpt.root}
+	mpt.shared.forks_lock.Lock()
+	defer mpt.shared.forks_lock.Unlock()
+	if mpt.fork != nil {
+		//the root may have been set without a write lock, by OpenMpt for example
+		mpt.fork.root = mpt.root
+		clone.fork.versions = append([]string{}, mpt.fork.versions...)
+	}
+	mpt.shared.forks[clone.fork] = true
+	return clone
+}
+
+/**
+Description:
+Release tells CollectGarbage that the fork of the trie is not used anymore: its root and its versions
+are not live roots after this call. The copies of the trie must not be used after Release.
+ */
+func (mpt *MerklePatriciaTrie) Release() {
+	if mpt.shared == nil || mpt.fork == nil {
+		return
+	}
+	mpt.shared.forks_lock.Lock()
+	defer mpt.shared.forks_lock.Unlock()
+	delete(mpt.shared.forks, mpt.fork)
+}
+
+/**
+Description:
+Merge brings the keys of other into the trie. The keys that are only in the trie are kept,
+the keys that are only in other are inserted, and resolver chooses the value of a key that is in both
+with different values (nil: the value of other wins). The subtrees with the same hash are skipped.
+The resolver runs without any lock held, so it can read the two tries.
+The diff is computed under read locks, and the write lock is only taken to apply the resolved pairs.
+If the trie was changed in between, the merge starts again from its new root.
+Arguments: other (*MerklePatriciaTrie), resolver (MergeResolver)
+Return: error if a node is missing or corrupt, the trie is not changed then
+ */
+func (mpt *MerklePatriciaTrie) Merge(other *MerklePatriciaTrie, resolver MergeResolver) error {
+	for {
+		//1.the changes, under read locks
+		unlock := read_lock_pair(mpt, other)
+		root := mpt.root
+		var changes []TrieChange
+		err := diff_helper(mpt, diff_position{root, 0}, other, diff_position{other.root, 0}, []uint8{}, &changes)
+		unlock()
+		if err != nil {
+			return err
+		}
+		//2.the resolved values, without lock
+		pairs := make([]KeyValuePair, 0, len(changes))
+		for _, change := range changes {
+			value := change.NewValue
+			switch change.Type {
+			case ChangeRemoved:
+				continue
+			case ChangeModified:
+				if resolver != nil {
+					value = resolver(change.Key, change.OldValue, change.NewValue)
+				}
+			}
+			pairs = append(pairs, KeyValuePair{Key: change.Key, Value: value})
+		}
+		//3.apply, if the trie is still at the root of the diff
+		mpt.write_lock()
+		if mpt.root != root {
+			mpt.write_unlock()
+			continue
+		}
+		for _, pair := range pairs {
+			if err := mpt.insert_key(stringToHex_array(pair.Key), pair.Value); err != nil {
+				//the nodes are never changed in place, the old root is the trie before the merge
+				mpt.root = root
+				mpt.write_unlock()
+				return err
+			}
+		}
+		mpt.write_unlock()
+		return nil
+	}
+}
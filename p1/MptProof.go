@@ -0,0 +1,115 @@
+package p1
+
+import (
+	"errors"
+)
+
+/**
+Description:
+GetProof collects the nodes on the path of a key, from the root down to the node where the search stops.
+If the key exists, the last node is the leaf (or the branch) holding the value.
+If the key doesn't exist, the last node is where the path diverges, which proves that the key is absent.
+Arguments: key (string)
+Return: the list of nodes from root to the end of the path ([]Node).
+ */
+func (mpt *MerklePatriciaTrie) GetProof(key string) []Node {
+	proof := []Node{}
+	if mpt == nil {
+		return proof
+	}
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	hex_array := stringToHex_array(key)
+	return mpt.proof_helper(hex_array, mpt.root, proof)
+}
+
+/**
+Description:
+The proof_helper function follows the path of hex_array like get_helper, and appends every visited node to proof.
+Arguments: hex_array(array of u8), hash(string), proof([]Node)
+Return: proof ([]Node)
+ */
+func (mpt *MerklePatriciaTrie) proof_helper(hex_array []uint8, hash string, proof []Node) []Node {
+	curNode := mpt.get_node(hash)
+	if curNode.node_type == 0 {
+		return proof
+	}
+	proof = append(proof, curNode)
+	switch curNode.node_type {
+	case 1: //Branch
+		if len(hex_array) > 0 && curNode.branch_value[hex_array[0]] != "" {
+			proof = mpt.proof_helper(hex_array[1:], curNode.branch_value[hex_array[0]], proof)
+		}
+	case 2: //Ext or Leaf
+		if is_ext_node(curNode.flag_value.encoded_prefix) {
+			decode_array := compact_decode(curNode.flag_value.encoded_prefix)
+			if common_length(hex_array, decode_array) == len(decode_array) {
+				proof = mpt.proof_helper(hex_array[len(decode_array):], curNode.flag_value.value, proof)
+			}
+		}
+	}
+	return proof
+}
+
+/**
+Description:
+VerifyProof checks a proof against a root hash only, without access to the trie.
+Every node in the proof is hashed with hash_node and must match the hash referenced by its parent (or the root).
+Arguments: root_hash (string), key (string), proof ([]Node)
+Return: the value of the key (string), whether the key exists (bool), and an error if the proof is invalid.
+If the proof is valid and the key is absent, it returns "", false, nil.
+ */
+func VerifyProof(root_hash string, key string, proof []Node) (string, bool, error) {
+	hex_array := stringToHex_array(key)
+	expected := root_hash
+	for i := 0; ; i++ {
+		if expected == "" {
+			//empty trie or empty slot, the key is absent
+			if i != len(proof) {
+				return "", false, errors.New("invalid_proof: unexpected nodes")
+			}
+			return "", false, nil
+		}
+		if i >= len(proof) {
+			return "", false, errors.New("invalid_proof: missing nodes")
+		}
+		curNode := proof[i]
+		if curNode.hash_node() != expected {
+			return "", false, errors.New("invalid_proof: hash mismatch")
+		}
+		last := i == len(proof)-1
+		switch curNode.node_type {
+		case 1: //Branch
+			if len(hex_array) == 0 {
+				if !last {
+					return "", false, errors.New("invalid_proof: unexpected nodes")
+				}
+				value, found := unwrap_branch_value(curNode.branch_value[16])
+				return value, found, nil
+			}
+			expected = curNode.branch_value[hex_array[0]]
+			hex_array = hex_array[1:]
+		case 2: //Ext or Leaf
+			decode_array := compact_decode(curNode.flag_value.encoded_prefix)
+			matched := common_length(hex_array, decode_array) == len(decode_array)
+			if !is_ext_node(curNode.flag_value.encoded_prefix) {
+				if !last {
+					return "", false, errors.New("invalid_proof: unexpected nodes")
+				}
+				if matched && len(hex_array) == len(decode_array) {
+					return curNode.flag_value.value, true, nil
+				}
+				return "", false, nil
+			}
+			if !matched {
+				//the path diverges inside the extension
+				expected = ""
+			} else {
+				expected = curNode.flag_value.value
+				hex_array = hex_array[len(decode_array):]
+			}
+		default:
+			return "", false, errors.New("invalid_proof: null node")
+		}
+	}
+}
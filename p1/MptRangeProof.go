@@ -0,0 +1,217 @@
+package p1
+
+import (
+	"errors"
+	"sort"
+)
+
+/**
+RangeProof proves that Pairs are exactly the pairs of the trie with Start <= key <= End.
+Nodes are the nodes on the paths to Start and to End (the boundary paths).
+Every subtree between the two paths is rebuilt from Pairs by the verifier, so no pair can be hidden or added.
+ */
+type RangeProof struct {
+	Start string
+	End   string
+	Pairs []KeyValuePair
+	Nodes []Node
+}
+
+/**
+Description:
+GetRangeProof proves the pairs with start <= key <= end. If limit > 0, at most limit pairs are returned,
+End is then the key of the last pair, and the next chunk starts at End + "\x00".
+Arguments: start (string), end (string), limit (int)
+Return: RangeProof
+ */
+func (mpt *MerklePatriciaTrie) GetRangeProof(start string, end string, limit int) RangeProof {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	proof := RangeProof{Start: start, End: end, Pairs: []KeyValuePair{}, Nodes: []Node{}}
+	end_array := stringToHex_array(end)
+	target, strict := stringToHex_array(start), false
+	for limit <= 0 || len(proof.Pairs) < limit {
+		key, value, found := mpt.find_first(mpt.root, []uint8{}, target, strict)
+		if !found || compare_hex(key, end_array) > 0 {
+			break
+		}
+		proof.Pairs = append(proof.Pairs, KeyValuePair{Key: Hex_arrayToString(key), Value: value})
+		target, strict = key, true
+	}
+	if limit > 0 && len(proof.Pairs) == limit {
+		proof.End = proof.Pairs[limit-1].Key
+	}
+	//the boundary paths, a node on both paths is sent once
+	sent := make(map[string]bool)
+	for _, bound := range []string{proof.Start, proof.End} {
+		for _, node := range mpt.proof_helper(stringToHex_array(bound), mpt.root, []Node{}) {
+			if hash := node.hash_node(); !sent[hash] {
+				sent[hash] = true
+				proof.Nodes = append(proof.Nodes, node)
+			}
+		}
+	}
+	return proof
+}
+
+/**
+range_verifier is the state of VerifyRangeProof.
+ */
+type range_verifier struct {
+	nodes    map[string]Node
+	start    []uint8
+	end      []uint8
+	keys     [][]uint8
+	values   []string
+	consumed int
+	scratch  MerklePatriciaTrie //rebuilds the subtrees inside the range
+}
+
+/**
+Description:
+VerifyRangeProof checks that proof.Pairs are all the pairs with proof.Start <= key <= proof.End
+in the trie of root_hash. The caller checks that proof.Start and proof.End are the range it asked for.
+Arguments: root_hash (string), proof (RangeProof)
+Return: error "invalid_proof: ..." if the proof is wrong.
+ */
+func VerifyRangeProof(root_hash string, proof RangeProof) error {
+	if proof.Start > proof.End {
+		return errors.New("invalid_proof: start after end")
+	}
+	verifier := range_verifier{
+		nodes: make(map[string]Node),
+		start: stringToHex_array(proof.Start),
+		end:   stringToHex_array(proof.End),
+	}
+	verifier.scratch.InitialWithStore(NewMemoryNodeStore())
+	for i, pair := range proof.Pairs {
+		if pair.Key < proof.Start || pair.Key > proof.End {
+			return errors.New("invalid_proof: pair outside of the range")
+		}
+		if i > 0 && proof.Pairs[i-1].Key >= pair.Key {
+			return errors.New("invalid_proof: pairs not sorted")
+		}
+		verifier.keys = append(verifier.keys, stringToHex_array(pair.Key))
+		verifier.values = append(verifier.values, pair.Value)
+	}
+	for _, node := range proof.Nodes {
+		if node.node_type == 2 && !valid_compact_prefix(node.flag_value.encoded_prefix) {
+			return errors.New("invalid_proof: bad compact prefix")
+		}
+		verifier.nodes[node.hash_node()] = node
+	}
+	if err := verifier.verify(root_hash, []uint8{}); err != nil {
+		return err
+	}
+	if verifier.consumed != len(verifier.keys) {
+		return errors.New("invalid_proof: pairs not in the trie")
+	}
+	return nil
+}
+
+/**
+Description:
+Check the subtree of hash at path:
+(1) outside the range: nothing to check
+(2) inside the range: rebuild it from the pairs starting with path, it must have the same hash
+(3) on a boundary: the node must be in the proof, check its value and its children
+Arguments: hash (string), path ([]uint8)
+Return: error
+ */
+func (verifier *range_verifier) verify(hash string, path []uint8) error {
+	if verifier.outside(path) {
+		return nil
+	}
+	if verifier.inside(path) {
+		first, last := verifier.pairs_with_prefix(path)
+		suffixes := make([][]uint8, 0, last-first)
+		for _, key := range verifier.keys[first:last] {
+			suffixes = append(suffixes, key[len(path):])
+		}
+		if verifier.scratch.build_node(suffixes, verifier.values[first:last]) != hash {
+			return errors.New("invalid_proof: pairs don't match the trie")
+		}
+		verifier.consumed += last - first
+		return nil
+	}
+	if hash == "" {
+		return nil
+	}
+	node, ok := verifier.nodes[hash]
+	if !ok {
+		return errors.New("invalid_proof: missing node")
+	}
+	switch node.node_type {
+	case 1: //Branch
+		if value, found := unwrap_branch_value(node.branch_value[16]); found {
+			if err := verifier.check_key(path, value); err != nil {
+				return err
+			}
+		}
+		for i, child := range node.branch_value[:16] {
+			if err := verifier.verify(child, append(append([]uint8{}, path...), uint8(i))); err != nil {
+				return err
+			}
+		}
+	case 2: //Ext or Leaf
+		full_path := append(append([]uint8{}, path...), compact_decode(node.flag_value.encoded_prefix)...)
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			return verifier.verify(node.flag_value.value, full_path)
+		}
+		return verifier.check_key(full_path, node.flag_value.value)
+	default:
+		return errors.New("invalid_proof: bad node")
+	}
+	return nil
+}
+
+/**
+Description: A key of the trie on a boundary: if it is in the range, it must be in the pairs with the same value.
+Arguments: key ([]uint8), value (string)
+Return: error
+ */
+func (verifier *range_verifier) check_key(key []uint8, value string) error {
+	if compare_hex(key, verifier.start) < 0 || compare_hex(key, verifier.end) > 0 {
+		return nil
+	}
+	first, last := verifier.pairs_with_prefix(key)
+	if first == last || len(verifier.keys[first]) != len(key) || verifier.values[first] != value {
+		return errors.New("invalid_proof: missing or wrong pair")
+	}
+	verifier.consumed++
+	return nil
+}
+
+/**
+Description: Every key starting with path is outside the range.
+Arguments: path ([]uint8)
+Return: bool
+ */
+func (verifier *range_verifier) outside(path []uint8) bool {
+	before_start := compare_hex(path, verifier.start) < 0 && common_length(path, verifier.start) != len(path)
+	return before_start || compare_hex(path, verifier.end) > 0
+}
+
+/**
+Description: Every key starting with path is inside the range.
+Arguments: path ([]uint8)
+Return: bool
+ */
+func (verifier *range_verifier) inside(path []uint8) bool {
+	after_end := compare_hex(path, verifier.end) >= 0 || common_length(path, verifier.end) == len(path)
+	return compare_hex(path, verifier.start) >= 0 && !after_end
+}
+
+/**
+Description: The pairs whose key starts with path, the keys are sorted so they are contiguous.
+Arguments: path ([]uint8)
+Return: the index of the first pair, and the index after the last one.
+ */
+func (verifier *range_verifier) pairs_with_prefix(path []uint8) (int, int) {
+	first := sort.Search(len(verifier.keys), func(i int) bool { return compare_hex(verifier.keys[i], path) >= 0 })
+	last := first
+	for last < len(verifier.keys) && common_length(verifier.keys[last], path) == len(path) {
+		last++
+	}
+	return first, last
+}
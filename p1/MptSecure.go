@@ -0,0 +1,188 @@
+package p1
+
+import (
+	"errors"
+	"golang.org/x/crypto/sha3"
+	"sync"
+)
+
+/**
+SecureMpt is a trie whose paths are the SHA3-256 hashes of the keys.
+The paths are uniformly distributed, so chosen keys with long shared prefixes can't build deep extension chains.
+The original keys are lost in the trie, an optional PreimageStore keeps them for GetMptMap and the iterator.
+ */
+type SecureMpt struct {
+	mpt       *MerklePatriciaTrie
+	preimages PreimageStore
+}
+
+/**
+PreimageStore keeps the original key of every hashed key of a SecureMpt.
+Get returns false if the preimage is unknown.
+ */
+type PreimageStore interface {
+	Get(hashed_key string) (string, bool)
+	Put(hashed_key string, key string)
+}
+
+/**
+MemoryPreimageStore keeps the preimages in a HashMap.
+ */
+type MemoryPreimageStore struct {
+	preimages map[string]string
+	lock      sync.RWMutex
+}
+
+/**
+Create a new in-memory preimage store
+Return type: *MemoryPreimageStore
+ */
+func NewMemoryPreimageStore() *MemoryPreimageStore {
+	return &MemoryPreimageStore{preimages: make(map[string]string)}
+}
+
+func (store *MemoryPreimageStore) Get(hashed_key string) (string, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	key, ok := store.preimages[hashed_key]
+	return key, ok
+}
+
+func (store *MemoryPreimageStore) Put(hashed_key string, key string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.preimages[hashed_key] = key
+}
+
+/**
+Description: Create an empty secure trie.
+Arguments: store (NodeStore), preimages (PreimageStore) -- nil if the original keys are not needed
+Return: *SecureMpt
+ */
+func NewSecureMpt(store NodeStore, preimages PreimageStore) *SecureMpt {
+	mpt := &MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	return &SecureMpt{mpt: mpt, preimages: preimages}
+}
+
+/**
+Description: The path of a key in the trie.
+Arguments: key (string)
+Return: the SHA3-256 of key (string of 32 bytes)
+ */
+func secure_key(key string) string {
+	hashed := sha3.Sum256([]byte(key))
+	return string(hashed[:])
+}
+
+/**
+Description: Get the underlying trie, for proofs, versions and root hashes. Its keys are the hashed keys.
+Return: *MerklePatriciaTrie
+ */
+func (secure *SecureMpt) Trie() *MerklePatriciaTrie {
+	return secure.mpt
+}
+
+func (secure *SecureMpt) GetRoot() string {
+	return secure.mpt.GetRoot()
+}
+
+func (secure *SecureMpt) Get(key string) (string, error) {
+	return secure.mpt.Get(secure_key(key))
+}
+
+/**
+Description: Insert a pair, and record the preimage of the hashed key.
+Arguments: key (string), value (string)
+Return: error of MerklePatriciaTrie.Insert
+ */
+func (secure *SecureMpt) Insert(key string, new_value string) error {
+	hashed_key := secure_key(key)
+	if secure.preimages != nil {
+		secure.preimages.Put(hashed_key, key)
+	}
+	return secure.mpt.Insert(hashed_key, new_value)
+}
+
+/**
+Description: Delete a key. The preimage is kept, the key may still be in older versions.
+Arguments: key (string)
+Return: string, error
+ */
+func (secure *SecureMpt) Delete(key string) (string, error) {
+	return secure.mpt.Delete(secure_key(key))
+}
+
+/**
+Description: Get all the pairs of the trie, with the original keys.
+Return: map[string]string, error "preimage_not_found" if a key has no preimage.
+ */
+func (secure *SecureMpt) GetMptMap() (map[string]string, error) {
+	hashed := secure.mpt.GetMptMap(secure.mpt.GetRoot(), []uint8{})
+	pairs := make(map[string]string, len(hashed))
+	for hashed_key, value := range hashed {
+		key, err := secure.preimage(hashed_key)
+		if err != nil {
+			return nil, err
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+/**
+Description: Get the original key of a hashed key.
+Arguments: hashed_key (string)
+Return: string, error "preimage_not_found"
+ */
+func (secure *SecureMpt) preimage(hashed_key string) (string, error) {
+	if secure.preimages == nil {
+		return "", errors.New("preimage_not_found")
+	}
+	key, ok := secure.preimages.Get(hashed_key)
+	if !ok {
+		return "", errors.New("preimage_not_found")
+	}
+	return key, nil
+}
+
+/**
+SecureIterator walks the pairs of a SecureMpt in the order of the hashed keys.
+ */
+type SecureIterator struct {
+	secure *SecureMpt
+	it     *MptIterator
+}
+
+/**
+Description: Create an iterator over all the pairs.
+Arguments: reverse (bool)
+Return: *SecureIterator
+ */
+func (secure *SecureMpt) NewIterator(reverse bool) *SecureIterator {
+	return &SecureIterator{secure: secure, it: secure.mpt.NewIterator("", reverse)}
+}
+
+func (it *SecureIterator) Next() bool {
+	return it.it.Next()
+}
+
+/**
+Description: The original key of the current pair.
+Return: string, error "preimage_not_found"
+ */
+func (it *SecureIterator) Key() (string, error) {
+	return it.secure.preimage(it.it.Key())
+}
+
+/**
+Description: The hashed key of the current pair, its path in the trie.
+Return: string
+ */
+func (it *SecureIterator) HashedKey() string {
+	return it.it.Key()
+}
+
+func (it *SecureIterator) Value() string {
+	return it.it.Value()
+}
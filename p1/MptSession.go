@@ -0,0 +1,275 @@
+package p1
+
+import (
+	"errors"
+)
+
+/**
+MptSession is a write session on a trie.
+Insert and Delete change the root of the session only, the trie keeps its root until Commit.
+Rollback throws the changes away, and deletes the nodes created by the session from db.
+A session is used by one goroutine, but the trie can be read and written while the session is open.
+Snapshot and RevertToSnapshot undo a part of the changes of the session, see journal_entry.
+ */
+type MptSession struct {
+	parent     *MerklePatriciaTrie
+	trie       MerklePatriciaTrie
+	store      *session_store
+	start      string
+	generation uint64
+	tainted    bool
+	closed     bool
+	journal    []journal_entry
+	snapshots  []session_snapshot
+	next_id    int
+}
+
+/**
+session_store records the nodes that were not in db before the session put them, in creation order.
+ */
+type session_store struct {
+	NodeStore
+	created map[string]bool
+	order   []string
+}
+
+func (store *session_store) Put(hash string, node Node) {
+	if _, ok := store.NodeStore.Get(hash); !ok && !store.created[hash] {
+		store.created[hash] = true
+		store.order = append(store.order, hash)
+	}
+	store.NodeStore.Put(hash, node)
+}
+
+/**
+journal_entry is the undo information of one Insert or Delete of a session:
+the root before the change, and the number of nodes created by the session before the change.
+The trie is persistent, so restoring the root restores every value, and the nodes created after are deleted.
+ */
+type journal_entry struct {
+	root    string
+	created int
+}
+
+/**
+session_snapshot is a snapshot id and the length of the journal when it was taken.
+ */
+type session_snapshot struct {
+	id      int
+	journal int
+}
+
+/**
+Description: Open a write session starting at the current root of the trie.
+Return: *MptSession
+ */
+func (mpt *MerklePatriciaTrie) BeginSession() *MptSession {
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	store := &session_store{NodeStore: mpt.db, created: make(map[string]bool)}
+	session := &MptSession{parent: mpt, store: store, start: mpt.root}
+	session.trie = MerklePatriciaTrie{db: store, root: mpt.root}
+	if mpt.shared != nil {
+		if mpt.shared.sessions == nil {
+			mpt.shared.sessions = make(map[*MptSession]bool)
+		}
+		mpt.shared.sessions[session] = true
+		//write_unlock increments the generation
+		session.generation = mpt.shared.generation + 1
+	}
+	return session
+}
+
+/**
+Description: Get the root of the session, with the changes of the session.
+Return: string
+ */
+func (session *MptSession) GetRoot() string {
+	session.parent.read_lock()
+	defer session.parent.read_unlock()
+	return session.trie.root
+}
+
+/**
+Description: Get a value, with the changes of the session.
+Arguments: key (string)
+Return: string, error
+ */
+func (session *MptSession) Get(key string) (string, error) {
+	session.parent.read_lock()
+	defer session.parent.read_unlock()
+	return session.trie.Get(key)
+}
+
+/**
+Description: Insert a pair in the session.
+Arguments: key (string), value (string)
+Return: error "session_closed" if the session was committed or rolled back, or the error of MerklePatriciaTrie.Insert
+ */
+func (session *MptSession) Insert(key string, new_value string) error {
+	if err := session.begin_write(); err != nil {
+		return err
+	}
+	defer session.end_write()
+	session.record()
+	return session.trie.Insert(key, new_value)
+}
+
+/**
+Description: Delete a key in the session, like MerklePatriciaTrie.Delete.
+Arguments: key (string)
+Return: string, error
+ */
+func (session *MptSession) Delete(key string) (string, error) {
+	if err := session.begin_write(); err != nil {
+		return "", err
+	}
+	defer session.end_write()
+	session.record()
+	return session.trie.Delete(key)
+}
+
+/**
+Description:
+Snapshot marks the current state of the session. Snapshots can be nested:
+reverting to a snapshot also discards the snapshots taken after it.
+Return: the snapshot id (int), -1 if the session is closed.
+ */
+func (session *MptSession) Snapshot() int {
+	if err := session.begin_write(); err != nil {
+		return -1
+	}
+	defer session.end_write()
+	id := session.next_id
+	session.next_id++
+	session.snapshots = append(session.snapshots, session_snapshot{id, len(session.journal)})
+	return id
+}
+
+/**
+Description:
+RevertToSnapshot undoes the changes made after the snapshot id, the changes made before are kept.
+It runs in O(changes after the snapshot).
+Arguments: id (int)
+Return: error "snapshot_not_found" if the snapshot was already reverted, or "session_closed"
+ */
+func (session *MptSession) RevertToSnapshot(id int) error {
+	if err := session.begin_write(); err != nil {
+		return err
+	}
+	defer session.end_write()
+	index := len(session.snapshots) - 1
+	for index >= 0 && session.snapshots[index].id != id {
+		index--
+	}
+	if index < 0 {
+		return errors.New("snapshot_not_found")
+	}
+	length := session.snapshots[index].journal
+	session.snapshots = session.snapshots[:index]
+	if length == len(session.journal) {
+		return nil
+	}
+	entry := session.journal[length]
+	session.trie.root = entry.root
+	created := session.store.order[entry.created:]
+	if !session.tainted {
+		for _, hash := range created {
+			session.store.NodeStore.Delete(hash)
+		}
+	}
+	for _, hash := range created {
+		delete(session.store.created, hash)
+	}
+	session.store.order = session.store.order[:entry.created]
+	session.journal = session.journal[:length]
+	return nil
+}
+
+/**
+Description: Add the undo information of the next change to the journal, the caller holds the write lock.
+ */
+func (session *MptSession) record() {
+	session.journal = append(session.journal, journal_entry{session.trie.root, len(session.store.order)})
+}
+
+/**
+Description:
+Commit sets the root of the trie to the root of the session, and closes the session.
+The commit fails if the root of the trie changed since the session was opened,
+the session stays open then, and can be rolled back.
+Return: the new root (string), error "session_conflict" or "session_closed"
+ */
+func (session *MptSession) Commit() (string, error) {
+	if err := session.begin_write(); err != nil {
+		return "", err
+	}
+	defer session.end_write()
+	if session.parent.root != session.start {
+		return "", errors.New("session_conflict")
+	}
+	session.parent.root = session.trie.root
+	session.close()
+	return session.trie.root, nil
+}
+
+/**
+Description:
+Rollback throws the changes of the session away, and closes the session. The root of the trie is unchanged.
+The nodes created by the session are deleted from db, unless another writer used db during the session:
+it may use the same nodes, so they are left to CollectGarbage.
+Return: error "session_closed"
+ */
+func (session *MptSession) Rollback() error {
+	if err := session.begin_write(); err != nil {
+		return err
+	}
+	defer session.end_write()
+	if !session.tainted {
+		for hash := range session.store.created {
+			session.store.NodeStore.Delete(hash)
+		}
+	}
+	session.trie.root = session.start
+	session.close()
+	return nil
+}
+
+/**
+Description:
+Lock the trie for a write of the session. If another writer used db since the last write of the session,
+the nodes created by the session may be shared with it.
+Return: error "session_closed"
+ */
+func (session *MptSession) begin_write() error {
+	parent := session.parent
+	parent.write_lock()
+	if session.closed {
+		parent.write_unlock()
+		return errors.New("session_closed")
+	}
+	if parent.shared != nil && parent.shared.generation != session.generation && len(session.store.created) > 0 {
+		session.tainted = true
+	}
+	return nil
+}
+
+func (session *MptSession) end_write() {
+	parent := session.parent
+	if parent.shared != nil {
+		session.generation = parent.shared.generation + 1
+	}
+	parent.write_unlock()
+}
+
+/**
+Description: Close the session, the caller holds the write lock.
+ */
+func (session *MptSession) close() {
+	session.closed = true
+	session.journal = nil
+	session.snapshots = nil
+	if session.parent.shared != nil {
+		delete(session.parent.shared.sessions, session)
+	}
+}
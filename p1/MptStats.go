@@ -0,0 +1,101 @@
+package p1
+
+/**
+MptStats describes the shape of a trie.
+(1) BranchNodes, ExtensionNodes, LeafNodes: the nodes reachable from root, a node shared by two subtrees counts once
+(2) EncodedBytes: the size of those nodes (see node_size)
+(3) Keys, KeyBytes, ValueBytes: the number of keys, and the total size of the keys and the values
+(4) MaxDepth, AverageDepth: the depth of a key is the number of nodes from the root to its value, the root included
+(5) DepthHistogram: the number of keys at each depth
+(6) OrphanNodes: the nodes of db that CollectGarbage would delete
+ */
+type MptStats struct {
+	BranchNodes    int
+	ExtensionNodes int
+	LeafNodes      int
+	EncodedBytes   int
+	Keys           int
+	KeyBytes       int
+	ValueBytes     int
+	MaxDepth       int
+	AverageDepth   float64
+	DepthHistogram map[int]int
+	OrphanNodes    int
+}
+
+/**
+Description: Compute the statistics of the trie.
+Return: MptStats
+ */
+func (mpt *MerklePatriciaTrie) Stats() MptStats {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	stats := MptStats{DepthHistogram: make(map[int]int)}
+	if mpt.db == nil {
+		return stats
+	}
+	total_depth := 0
+	mpt.stats_helper(mpt.root, 0, 1, make(map[string]bool), &stats, &total_depth)
+	if stats.Keys > 0 {
+		stats.AverageDepth = float64(total_depth) / float64(stats.Keys)
+	}
+	live := mpt.live_nodes(nil)
+	for _, hash := range mpt.db.Hashes() {
+		if !live[hash] {
+			stats.OrphanNodes++
+		}
+	}
+	return stats
+}
+
+/**
+Description: Add the nodes and the keys below hash to stats.
+Arguments: hash (string), path_length (nibbles from the root), depth (int), visited, stats, total_depth
+ */
+func (mpt *MerklePatriciaTrie) stats_helper(hash string, path_length int, depth int, visited map[string]bool,
+	stats *MptStats, total_depth *int) {
+	if hash == "" {
+		return
+	}
+	node := mpt.get_node(hash)
+	first := !visited[hash]
+	visited[hash] = true
+	add_key := func(path_length int, value string) {
+		stats.Keys++
+		stats.KeyBytes += path_length / 2
+		stats.ValueBytes += len(value)
+		stats.DepthHistogram[depth]++
+		*total_depth += depth
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+	}
+	if first && node.node_type != 0 {
+		stats.EncodedBytes += node_size(node)
+	}
+	switch node.node_type {
+	case 1: //Branch
+		if first {
+			stats.BranchNodes++
+		}
+		if value, found := unwrap_branch_value(node.branch_value[16]); found {
+			add_key(path_length, value)
+		}
+		for _, child := range node.branch_value[:16] {
+			mpt.stats_helper(child, path_length+1, depth+1, visited, stats, total_depth)
+		}
+	case 2: //Ext or Leaf
+		path_length += len(compact_decode(node.flag_value.encoded_prefix))
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			if first {
+				stats.ExtensionNodes++
+			}
+			mpt.stats_helper(node.flag_value.value, path_length, depth+1, visited, stats, total_depth)
+		} else {
+			if first {
+				stats.LeafNodes++
+			}
+			add_key(path_length, node.flag_value.value)
+		}
+	}
+}
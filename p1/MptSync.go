@@ -0,0 +1,229 @@
+package p1
+
+import (
+	"errors"
+)
+
+/**
+NodeFetcher gets nodes from a peer by hash.
+Fetch returns the canonical encodings (see encode_node) of the nodes, in the order of hashes,
+nil for a node the peer doesn't have.
+ */
+type NodeFetcher interface {
+	Fetch(hashes []string) ([][]byte, error)
+}
+
+/**
+TrieFetcher is a NodeFetcher backed by a local trie, it serves the nodes of its db.
+ */
+type TrieFetcher struct {
+	mpt *MerklePatriciaTrie
+}
+
+/**
+Create a fetcher serving the nodes of mpt
+Return type: *TrieFetcher
+ */
+func NewTrieFetcher(mpt *MerklePatriciaTrie) *TrieFetcher {
+	return &TrieFetcher{mpt: mpt}
+}
+
+func (fetcher *TrieFetcher) Fetch(hashes []string) ([][]byte, error) {
+	fetcher.mpt.read_lock()
+	defer fetcher.mpt.read_unlock()
+	data := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		if node, ok := fetcher.mpt.db.Get(hash); ok {
+			data[i] = encode_node(node)
+		}
+	}
+	return data, nil
+}
+
+/**
+MptSync downloads the trie of a root hash into a store, breadth-first, checking every node against its hash.
+The queue holds the missing hashes whose parent is in the store.
+The store is the state of the sync: a new MptSync on the same store resumes an interrupted sync.
+Example:
+sync := p1.NewMptSync(root, store)
+err := sync.Run(fetcher, 64)
+mpt, err := sync.Trie()
+ */
+type MptSync struct {
+	root    string
+	store   NodeStore
+	queue   []string
+	queued  map[string]bool
+	fetched int
+}
+
+/**
+Description:
+Create a sync of root into store. The nodes already in store (from an interrupted sync) are walked,
+and only their missing children are queued.
+Arguments: root (string), store (NodeStore)
+Return: *MptSync
+ */
+func NewMptSync(root string, store NodeStore) *MptSync {
+	sync := &MptSync{root: root, store: store, queued: make(map[string]bool)}
+	visited := make(map[string]bool)
+	level := []string{root}
+	for len(level) > 0 {
+		var next []string
+		for _, hash := range level {
+			if hash == "" || visited[hash] {
+				continue
+			}
+			visited[hash] = true
+			node, ok := store.Get(hash)
+			if !ok {
+				sync.enqueue(hash)
+				continue
+			}
+			next = append(next, node_children(node)...)
+		}
+		level = next
+	}
+	return sync
+}
+
+/**
+Description: Get the missing hashes that will be fetched next.
+Return: []string
+ */
+func (sync *MptSync) Missing() []string {
+	return append([]string{}, sync.queue...)
+}
+
+/**
+Description: Whether every node of the trie is in the store.
+Return: bool
+ */
+func (sync *MptSync) Done() bool {
+	return len(sync.queue) == 0
+}
+
+/**
+Description: Get the number of nodes fetched and stored by this sync.
+Return: int
+ */
+func (sync *MptSync) Fetched() int {
+	return sync.fetched
+}
+
+/**
+Description:
+Step fetches up to batch missing nodes. Every node is checked against its hash before it is stored,
+and its missing children are queued. A node that the peer doesn't have, or that is invalid, stays missing.
+Arguments: fetcher (NodeFetcher), batch (int)
+Return: error from the fetcher, "node_not_available" or "invalid_node: ..."
+ */
+func (sync *MptSync) Step(fetcher NodeFetcher, batch int) error {
+	if batch <= 0 || batch > len(sync.queue) {
+		batch = len(sync.queue)
+	}
+	hashes := sync.queue[:batch]
+	data, err := fetcher.Fetch(hashes)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(hashes) {
+		return errors.New("invalid_node: wrong number of nodes")
+	}
+	sync.queue = append([]string{}, sync.queue[batch:]...)
+	var failure error
+	for i, hash := range hashes {
+		node, err := check_fetched_node(hash, data[i])
+		if err != nil {
+			//retry later, maybe with another peer
+			sync.queue = append(sync.queue, hash)
+			failure = err
+			continue
+		}
+		sync.store.Put(hash, node)
+		delete(sync.queued, hash)
+		sync.fetched++
+		for _, child := range node_children(node) {
+			if _, ok := sync.store.Get(child); !ok {
+				sync.enqueue(child)
+			}
+		}
+	}
+	return failure
+}
+
+/**
+Description: Run fetches the missing nodes until the trie is complete.
+Arguments: fetcher (NodeFetcher), batch (int)
+Return: the first error, the sync can be resumed after it.
+ */
+func (sync *MptSync) Run(fetcher NodeFetcher, batch int) error {
+	for !sync.Done() {
+		if err := sync.Step(fetcher, batch); err != nil {
+			return err
+		}
+	}
+	if store, ok := sync.store.(Flusher); ok {
+		return store.Flush()
+	}
+	return nil
+}
+
+/**
+Description: Open the synced trie.
+Return: MerklePatriciaTrie, error "sync_not_done" if nodes are missing.
+ */
+func (sync *MptSync) Trie() (MerklePatriciaTrie, error) {
+	if !sync.Done() {
+		return MerklePatriciaTrie{}, errors.New("sync_not_done")
+	}
+	return OpenMpt(sync.store, sync.root)
+}
+
+/**
+Description: Decode a fetched node and check it against its hash.
+Arguments: hash (string), data ([]byte)
+Return: Node, error "node_not_available" or "invalid_node: ..."
+ */
+func check_fetched_node(hash string, data []byte) (Node, error) {
+	if data == nil {
+		return Node{}, errors.New("node_not_available")
+	}
+	node, err := decode_node(data)
+	if err != nil {
+		return Node{}, errors.New("invalid_node: " + err.Error())
+	}
+	if node.node_type == 0 || node.hash_node() != hash {
+		return Node{}, errors.New("invalid_node: hash mismatch")
+	}
+	return node, nil
+}
+
+func (sync *MptSync) enqueue(hash string) {
+	if !sync.queued[hash] {
+		sync.queued[hash] = true
+		sync.queue = append(sync.queue, hash)
+	}
+}
+
+/**
+Description: The hashes of the children of a node.
+Arguments: node (Node)
+Return: []string
+ */
+func node_children(node Node) []string {
+	var children []string
+	switch node.node_type {
+	case 1: //Branch
+		for _, child := range node.branch_value[:16] {
+			if child != "" {
+				children = append(children, child)
+			}
+		}
+	case 2: //Ext or Leaf
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			children = append(children, node.flag_value.value)
+		}
+	}
+	return children
+}
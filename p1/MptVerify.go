@@ -0,0 +1,170 @@
+package p1
+
+import (
+	"fmt"
+)
+
+/**
+VerifyIssueKind is the kind of a problem found by Verify.
+ */
+type VerifyIssueKind int
+
+const (
+	IssueHashMismatch VerifyIssueKind = iota //the hash of the node is not its key in db
+	IssueMissingNode                         //a node is not in db
+	IssueBranchTooFewChildren                //a branch with less than two children (the value counts as a child)
+	IssueExtensionChild                      //an extension pointing at an extension or a leaf
+	IssueBadCompactPrefix                    //a compact-encoded path that can't be decoded
+	IssueCorruptNode                         //a node of unknown type, or a bad branch value
+)
+
+/**
+VerifyIssue is one problem found by Verify.
+Path is the nibble path of the node from the root, Repair is the way to fix the problem.
+ */
+type VerifyIssue struct {
+	Kind    VerifyIssueKind
+	Hash    string
+	Path    []uint8
+	Message string
+	Repair  string
+}
+
+/**
+VerifyReport is the result of Verify: the number of nodes checked, and the problems found.
+ */
+type VerifyReport struct {
+	NodesChecked int
+	Issues       []VerifyIssue
+}
+
+/**
+Description: Whether the trie has no problem.
+Return: bool
+ */
+func (report VerifyReport) Ok() bool {
+	return len(report.Issues) == 0
+}
+
+/**
+Description: The first problem as an error, to tell a broken database from an absent key.
+Return: nil, *MissingNodeError or *CorruptNodeError
+ */
+func (report VerifyReport) Err() error {
+	if report.Ok() {
+		return nil
+	}
+	issue := report.Issues[0]
+	if issue.Kind == IssueMissingNode {
+		return &MissingNodeError{issue.Hash}
+	}
+	return &CorruptNodeError{Hash: issue.Hash, Reason: issue.Message}
+}
+
+func (issue VerifyIssue) String() string {
+	return fmt.Sprintf("%s at path %v: %s (repair: %s)", issue.Hash, issue.Path, issue.Message, issue.Repair)
+}
+
+/**
+Description:
+Verify walks the trie from root and checks every node:
+(1) the hash of the node, recomputed with hash_node, is its key in db
+(2) the children of the node are in db
+(3) a branch has at least two children
+(4) an extension points at a branch
+(5) the compact-encoded paths are valid
+Return: VerifyReport
+ */
+func (mpt *MerklePatriciaTrie) Verify() VerifyReport {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	report := VerifyReport{}
+	if mpt.root != "" {
+		mpt.verify_node(mpt.root, []uint8{}, make(map[string]bool), &report)
+	}
+	return report
+}
+
+/**
+Description: Check the node hash and the nodes below it. A node shared by two parents is checked once.
+Arguments: hash (string), path ([]uint8), visited (map[string]bool), report (*VerifyReport)
+ */
+func (mpt *MerklePatriciaTrie) verify_node(hash string, path []uint8, visited map[string]bool, report *VerifyReport) {
+	if visited[hash] {
+		return
+	}
+	visited[hash] = true
+	add_issue := func(kind VerifyIssueKind, message string, repair string) {
+		issue := VerifyIssue{kind, hash, append([]uint8{}, path...), message, repair}
+		report.Issues = append(report.Issues, issue)
+	}
+	var node Node
+	var ok bool
+	if mpt.db != nil {
+		node, ok = mpt.db.Get(hash)
+	}
+	if !ok {
+		add_issue(IssueMissingNode, "node not in db", "restore the node from a replica or a serialized trie")
+		return
+	}
+	report.NodesChecked++
+	if node.hash_node() != hash {
+		add_issue(IssueHashMismatch, "recomputed hash "+node.hash_node(), "restore the node, its content was changed")
+	}
+	switch node.node_type {
+	case 1: //Branch
+		if node.branch_value[16] != "" && node.branch_value[16][0] != 'v' {
+			add_issue(IssueCorruptNode, "bad branch value", "restore the node")
+		}
+		if elements_sum(node.branch_value) < 2 {
+			add_issue(IssueBranchTooFewChildren, "branch with less than two children",
+				"replace the branch by its only child, with the nibble prepended to its path")
+		}
+		for i, child := range node.branch_value[:16] {
+			if child != "" {
+				mpt.verify_node(child, append(append([]uint8{}, path...), uint8(i)), visited, report)
+			}
+		}
+	case 2: //Ext or Leaf
+		prefix := node.flag_value.encoded_prefix
+		if !valid_compact_prefix(prefix) {
+			add_issue(IssueBadCompactPrefix, fmt.Sprintf("bad compact prefix %v", prefix), "re-encode the path with compact_encode")
+			return
+		}
+		if !is_ext_node(prefix) {
+			return
+		}
+		decoded := compact_decode(prefix)
+		if len(decoded) == 0 {
+			add_issue(IssueBadCompactPrefix, "extension with an empty path", "replace the extension by its child")
+		}
+		child_path := append(append([]uint8{}, path...), decoded...)
+		child := node.flag_value.value
+		if next, ok := mpt.db.Get(child); ok && next.node_type == 2 && len(next.flag_value.encoded_prefix) > 0 {
+			if is_ext_node(next.flag_value.encoded_prefix) {
+				add_issue(IssueExtensionChild, "extension pointing at an extension", "merge the two extensions")
+			} else {
+				add_issue(IssueExtensionChild, "extension pointing at a leaf", "merge the extension into the leaf")
+			}
+		}
+		mpt.verify_node(child, child_path, visited, report)
+	default:
+		add_issue(IssueCorruptNode, fmt.Sprintf("unknown node type %d", node.node_type), "restore the node")
+	}
+}
+
+/**
+Description: Check a compact-encoded path: a known flag, and a zero padding nibble for an even length.
+Arguments: prefix ([]uint8)
+Return: bool
+ */
+func valid_compact_prefix(prefix []uint8) bool {
+	if len(prefix) == 0 {
+		return false
+	}
+	flag := prefix[0] / 16
+	if flag > 3 {
+		return false
+	}
+	return flag%2 == 1 || prefix[0]%16 == 0
+}
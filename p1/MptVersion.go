@@ -0,0 +1,104 @@
+package p1
+
+import (
+	"errors"
+)
+
+/**
+MptView is a read-only view of a trie at a committed root.
+It shares db with the trie, so unchanged nodes are shared between versions.
+ */
+type MptView struct {
+	mpt MerklePatriciaTrie
+}
+
+/**
+Description:
+Commit records the current root as a new version and returns it.
+Insert and Delete never delete old nodes from db, so every committed root can still be read
+until it is pruned (see Prune). If db can be flushed (like FileNodeStore), it is flushed.
+Return: the committed root (string), error
+ */
+func (mpt *MerklePatriciaTrie) Commit() (string, error) {
+	if mpt.fork == nil {
+		return "", errors.New("mpt_not_initialized")
+	}
+	mpt.write_lock()
+	defer mpt.write_unlock()
+	mpt.fork.versions = append(mpt.fork.versions, mpt.root)
+	if store, ok := mpt.db.(Flusher); ok {
+		if err := store.Flush(); err != nil {
+			return mpt.root, err
+		}
+	}
+	return mpt.root, nil
+}
+
+/**
+Description: Get the committed roots of the fork of the trie, the first committed version is at index 0.
+Return: []string
+ */
+func (mpt *MerklePatriciaTrie) GetVersions() []string {
+	if mpt.fork == nil {
+		return []string{}
+	}
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	return append([]string{}, mpt.fork.versions...)
+}
+
+/**
+Description: Open a read-only view at a committed root.
+Arguments: root (string)
+Return: *MptView, error if the root was never committed.
+ */
+func (mpt *MerklePatriciaTrie) ViewAt(root string) (*MptView, error) {
+	if mpt.fork == nil {
+		return nil, errors.New("version_not_found")
+	}
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	for _, v := range mpt.fork.versions {
+		if v == root {
+			return &MptView{MerklePatriciaTrie{db: mpt.db, root: root, shared: mpt.shared}}, nil
+		}
+	}
+	return nil, errors.New("version_not_found")
+}
+
+/**
+Description: Open a read-only view at the committed version number (0 is the first commit).
+Arguments: version (int)
+Return: *MptView, error if the version doesn't exist.
+ */
+func (mpt *MerklePatriciaTrie) ViewAtVersion(version int) (*MptView, error) {
+	if mpt.fork == nil {
+		return nil, errors.New("version_not_found")
+	}
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	if version < 0 || version >= len(mpt.fork.versions) {
+		return nil, errors.New("version_not_found")
+	}
+	return &MptView{MerklePatriciaTrie{db: mpt.db, root: mpt.fork.versions[version], shared: mpt.shared}}, nil
+}
+
+func (view *MptView) GetRoot() string {
+	return view.mpt.GetRoot()
+}
+
+func (view *MptView) Get(key string) (string, error) {
+	return view.mpt.Get(key)
+}
+
+func (view *MptView) GetMptMap() map[string]string {
+	return view.mpt.GetMptMap(view.mpt.GetRoot(), []uint8{})
+}
+
+func (view *MptView) GetProof(key string) []Node {
+	return view.mpt.GetProof(key)
+}
+
+func (view *MptView) NewIterator(prefix string, reverse bool) *MptIterator {
+	return view.mpt.NewIterator(prefix, reverse)
+}
@@ -0,0 +1,294 @@
+package p1
+
+import (
+	"encoding/hex"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+/**
+Canonical binary encoding of the nodes (RLP).
+(1) Branch: a list of 17 items, the hashes of the 16 children (32 bytes, or empty) and the value.
+The value item is the stored value: "v" followed by the value if a key ends at the branch (see wrap_branch_value),
+empty otherwise, so the empty value and no value have different encodings and hashes.
+(2) Leaf: a list of 2 items, the compact-encoded path and the value.
+(3) Extension: a list of 2 items, the compact-encoded path and the hash of the next node (32 bytes).
+(4) Null: the empty string.
+The hash of a node is the SHA3-256 of this encoding, so it commits to the path and the value of the node.
+ */
+
+/**
+HashMode is the way the root hash of a trie is computed by RootHash().
+HashModeCanonical: the hash of the root node in db (see hash_node).
+HashModeEthereum: the Ethereum state root, Keccak-256 over the Ethereum encoding of the nodes,
+where nodes shorter than 32 bytes are embedded in their parent instead of hashed.
+ */
+type HashMode int
+
+const (
+	HashModeCanonical HashMode = iota
+	HashModeEthereum
+)
+
+/**
+Description: Encode a node into its canonical binary format.
+Arguments: node (Node)
+Return: []byte
+ */
+func encode_node(node Node) []byte {
+	switch node.node_type {
+	case 1: //Branch
+		items := make([][]byte, 17)
+		for i, v := range node.branch_value[:16] {
+			items[i] = rlp_encode_bytes(hash_to_bytes(v))
+		}
+		items[16] = rlp_encode_bytes([]byte(node.branch_value[16]))
+		return rlp_encode_list(items)
+	case 2: //Ext or Leaf
+		path := rlp_encode_bytes(node.flag_value.encoded_prefix)
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			return rlp_encode_list([][]byte{path, rlp_encode_bytes(hash_to_bytes(node.flag_value.value))})
+		}
+		return rlp_encode_list([][]byte{path, rlp_encode_bytes([]byte(node.flag_value.value))})
+	}
+	return rlp_encode_bytes(nil)
+}
+
+/**
+Description: Decode a node from its canonical binary format.
+Arguments: data ([]byte)
+Return: Node, error
+ */
+func decode_node(data []byte) (Node, error) {
+	item, rest, err := rlp_decode(data)
+	if err != nil {
+		return Node{}, err
+	}
+	if len(rest) != 0 {
+		return Node{}, &CorruptNodeError{Reason: "trailing bytes"}
+	}
+	if !item.is_list {
+		if len(item.bytes) == 0 {
+			return Node{}, nil
+		}
+		return Node{}, &CorruptNodeError{Reason: "not a list"}
+	}
+	for _, child := range item.items {
+		if child.is_list {
+			return Node{}, &CorruptNodeError{Reason: "nested list"}
+		}
+	}
+	switch len(item.items) {
+	case 17:
+		node := Node{node_type: 1}
+		for i, child := range item.items[:16] {
+			hash, err := bytes_to_hash(child.bytes)
+			if err != nil {
+				return Node{}, err
+			}
+			node.branch_value[i] = hash
+		}
+		node.branch_value[16] = string(item.items[16].bytes)
+		if node.branch_value[16] != "" && node.branch_value[16][0] != 'v' {
+			return Node{}, &CorruptNodeError{Reason: "bad branch value"}
+		}
+		return node, nil
+	case 2:
+		prefix := item.items[0].bytes
+		if len(prefix) == 0 || prefix[0]/16 > 3 {
+			return Node{}, &CorruptNodeError{Reason: "bad compact prefix"}
+		}
+		node := Node{node_type: 2, flag_value: Flag_value{append([]uint8{}, prefix...), string(item.items[1].bytes)}}
+		if is_ext_node(prefix) {
+			hash, err := bytes_to_hash(item.items[1].bytes)
+			if err != nil || hash == "" {
+				return Node{}, &CorruptNodeError{Reason: "bad extension hash"}
+			}
+			node.flag_value.value = hash
+		}
+		return node, nil
+	}
+	return Node{}, &CorruptNodeError{Reason: "wrong number of items"}
+}
+
+/**
+Description: Convert a node hash "HashStart_<hex>_HashEnd" to its 32 bytes. An empty hash is empty.
+Arguments: hash (string)
+Return: []byte
+ */
+func hash_to_bytes(hash string) []byte {
+	if hash == "" {
+		return nil
+	}
+	raw := strings.TrimSuffix(strings.TrimPrefix(hash, "HashStart_"), "_HashEnd")
+	bytes, err := hex.DecodeString(raw)
+	if err != nil {
+		return []byte(hash)
+	}
+	return bytes
+}
+
+/**
+Description: Convert 32 bytes back to a node hash string, the reverse of hash_to_bytes.
+Arguments: bytes ([]byte)
+Return: string, error
+ */
+func bytes_to_hash(bytes []byte) (string, error) {
+	if len(bytes) == 0 {
+		return "", nil
+	}
+	if len(bytes) != 32 {
+		return "", &CorruptNodeError{Reason: "bad hash length"}
+	}
+	return "HashStart_" + hex.EncodeToString(bytes) + "_HashEnd", nil
+}
+
+/**
+Description: Compute the root hash of the trie in the given mode, as a hex string.
+Arguments: mode (HashMode)
+Return: string
+ */
+func (mpt *MerklePatriciaTrie) RootHash(mode HashMode) string {
+	mpt.read_lock()
+	defer mpt.read_unlock()
+	if mode == HashModeEthereum {
+		keccak := sha3.NewLegacyKeccak256()
+		keccak.Write(mpt.eth_encode(mpt.root))
+		return hex.EncodeToString(keccak.Sum(nil))
+	}
+	if mpt.root == "" {
+		node := Node{}
+		return hex.EncodeToString(hash_to_bytes(node.hash_node()))
+	}
+	return hex.EncodeToString(hash_to_bytes(mpt.root))
+}
+
+/**
+Description: Ethereum encoding of the node hash, with its children encoded recursively.
+Arguments: hash (string)
+Return: []byte
+ */
+func (mpt *MerklePatriciaTrie) eth_encode(hash string) []byte {
+	node := mpt.get_node(hash)
+	switch node.node_type {
+	case 1: //Branch
+		items := make([][]byte, 17)
+		for i, v := range node.branch_value[:16] {
+			items[i] = mpt.eth_ref(v)
+		}
+		value, _ := unwrap_branch_value(node.branch_value[16])
+		items[16] = rlp_encode_bytes([]byte(value))
+		return rlp_encode_list(items)
+	case 2: //Ext or Leaf
+		path := rlp_encode_bytes(node.flag_value.encoded_prefix)
+		if is_ext_node(node.flag_value.encoded_prefix) {
+			return rlp_encode_list([][]byte{path, mpt.eth_ref(node.flag_value.value)})
+		}
+		return rlp_encode_list([][]byte{path, rlp_encode_bytes([]byte(node.flag_value.value))})
+	}
+	return rlp_encode_bytes(nil)
+}
+
+/**
+Description: Ethereum reference to a child node: the node itself if it is shorter than 32 bytes, its Keccak-256 hash otherwise.
+Arguments: hash (string)
+Return: []byte
+ */
+func (mpt *MerklePatriciaTrie) eth_ref(hash string) []byte {
+	if hash == "" {
+		return rlp_encode_bytes(nil)
+	}
+	encoded := mpt.eth_encode(hash)
+	if len(encoded) < 32 {
+		return encoded
+	}
+	keccak := sha3.NewLegacyKeccak256()
+	keccak.Write(encoded)
+	return rlp_encode_bytes(keccak.Sum(nil))
+}
+
+/**
+rlp_item is a decoded RLP item: a byte string, or a list of items.
+ */
+type rlp_item struct {
+	is_list bool
+	bytes   []byte
+	items   []rlp_item
+}
+
+func rlp_encode_bytes(bytes []byte) []byte {
+	if len(bytes) == 1 && bytes[0] < 0x80 {
+		return []byte{bytes[0]}
+	}
+	return append(rlp_encode_length(len(bytes), 0x80), bytes...)
+}
+
+func rlp_encode_list(items [][]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlp_encode_length(len(payload), 0xc0), payload...)
+}
+
+func rlp_encode_length(length int, offset byte) []byte {
+	if length <= 55 {
+		return []byte{offset + byte(length)}
+	}
+	var length_bytes []byte
+	for l := length; l > 0; l >>= 8 {
+		length_bytes = append([]byte{byte(l)}, length_bytes...)
+	}
+	return append([]byte{offset + 55 + byte(len(length_bytes))}, length_bytes...)
+}
+
+/**
+Description: Decode the first RLP item of data.
+Arguments: data ([]byte)
+Return: the item, the rest of data, error
+ */
+func rlp_decode(data []byte) (rlp_item, []byte, error) {
+	if len(data) == 0 {
+		return rlp_item{}, nil, &CorruptNodeError{Reason: "empty rlp"}
+	}
+	prefix := data[0]
+	if prefix < 0x80 {
+		return rlp_item{bytes: data[:1]}, data[1:], nil
+	}
+	is_list := prefix >= 0xc0
+	offset := byte(0x80)
+	if is_list {
+		offset = 0xc0
+	}
+	length := int(prefix - offset)
+	start := 1
+	if length > 55 {
+		size := length - 55
+		if len(data) < 1+size || size > 4 {
+			return rlp_item{}, nil, &CorruptNodeError{Reason: "bad rlp length"}
+		}
+		length = 0
+		for _, b := range data[1 : 1+size] {
+			length = length<<8 | int(b)
+		}
+		start = 1 + size
+	}
+	if len(data)-start < length {
+		return rlp_item{}, nil, &CorruptNodeError{Reason: "rlp too short"}
+	}
+	payload := data[start : start+length]
+	rest := data[start+length:]
+	if !is_list {
+		return rlp_item{bytes: payload}, rest, nil
+	}
+	item := rlp_item{is_list: true}
+	for len(payload) > 0 {
+		child, remain, err := rlp_decode(payload)
+		if err != nil {
+			return rlp_item{}, nil, err
+		}
+		item.items = append(item.items, child)
+		payload = remain
+	}
+	return item, rest, nil
+}
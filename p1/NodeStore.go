@@ -0,0 +1,71 @@
+package p1
+
+import (
+	"sync"
+)
+
+/**
+NodeStore is where a MerklePatriciaTrie keeps its nodes.
+The key of a node is its hash value (Node.hash_node()).
+Get returns false if the node is not in the store.
+Hashes returns the hashes of all the nodes in the store, in no particular order.
+ */
+type NodeStore interface {
+	Get(hash string) (Node, bool)
+	Put(hash string, node Node)
+	Delete(hash string)
+	Hashes() []string
+}
+
+/**
+Flusher is a NodeStore that buffers its writes (FileNodeStore, CachedNodeStore): Flush makes them durable.
+Commit, CollectGarbage and MptSync.Run flush a store that is a Flusher.
+ */
+type Flusher interface {
+	Flush() error
+}
+
+/**
+MemoryNodeStore keeps the nodes in a HashMap. It is the default store of a trie.
+ */
+type MemoryNodeStore struct {
+	nodes map[string]Node
+	lock  sync.RWMutex
+}
+
+/**
+Create a new in-memory node store
+Return type: *MemoryNodeStore
+ */
+func NewMemoryNodeStore() *MemoryNodeStore {
+	return &MemoryNodeStore{nodes: make(map[string]Node)}
+}
+
+func (store *MemoryNodeStore) Get(hash string) (Node, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	node, ok := store.nodes[hash]
+	return node, ok
+}
+
+func (store *MemoryNodeStore) Put(hash string, node Node) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.nodes[hash] = node
+}
+
+func (store *MemoryNodeStore) Delete(hash string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.nodes, hash)
+}
+
+func (store *MemoryNodeStore) Hashes() []string {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	hashes := make([]string, 0, len(store.nodes))
+	for hash := range store.nodes {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
@@ -4,9 +4,11 @@ import (
 	"../p1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/sha3"
 	"log"
+	"sort"
 )
 
 /**
@@ -17,10 +19,13 @@ The value must be in the UNIX timestamp format such as 1550013938
 (3) Hash: string.
 (4) ParentHash: string
 (5) Size: int32
+(6) Nonce: uint64, found by mining (see Miner)
+(7) Difficulty: uint64, the hash must be below 2^256 / Difficulty. 0 means no proof of work.
+(8) Version: uint32, the scheme of the hash preimage (see EncodeHeader). 0 is the legacy scheme.
 Value: mpt MerklePatriciaTrie
 Here's the summary of block structure:
 The size is the length of the byte array of the block value
-Block: Block{Header{Height, Timestamp, Hash, ParentHash, Size}, value}
+Block: Block{Header{Height, Timestamp, Hash, ParentHash, Size, Nonce, Difficulty, Version}, value}
  */
 type Block struct {
 	Header Header `json:"header"`
@@ -36,6 +41,9 @@ type Header struct {
 	Hash string `json:"hash"`
 	ParentHash string `json:"parenthash"`
 	Size int32 `json:"size"`
+	Nonce uint64 `json:"nonce"`
+	Difficulty uint64 `json:"difficulty"`
+	Version uint32 `json:"version"`
 }
 
 /**
@@ -47,6 +55,9 @@ type BlockJson struct {
 	Hash       string            `json:"hash"`
 	ParentHash string            `json:"parentHash"`
 	Size       int32             `json:"size"`
+	Nonce      uint64            `json:"nonce,omitempty"`
+	Difficulty uint64            `json:"difficulty,omitempty"`
+	Version    uint32            `json:"version,omitempty"`
 	MPT        map[string]string `json:"mpt"`
 }
 
@@ -65,17 +76,38 @@ func NewBlock(height int32, timeStamp int64, parentHash string, value p1.MerkleP
 
 /**
 Description: This function takes arguments(such as height, parentHash, and value of MPT type) and forms a block.
-This is a method of the block struct.
+This is a method of the block struct. The block is hashed with CanonicalHeaderVersion.
+Compatibility: the first version hashed the legacy preimage, the hash of the same block is different now.
 Block: Block{Header{Height, Timestamp, Hash, ParentHash, Size}, value}
 Argument: height, timeStamp, hash, parentHash, value(mpt type)
  */
 func (b *Block) Initial(height int32, timeStamp int64, parentHash string, value p1.MerklePatriciaTrie) {
 	//The size is the length of the byte array of the block value
 	size := len(value.MptToByteArray())
-	b.Header = Header{height, timeStamp, "", parentHash, int32(size)}
+	b.Header = Header{Height: height, Timestamp: timeStamp, ParentHash: parentHash, Size: int32(size),
+		Version: CanonicalHeaderVersion}
+	//set the value before the hash, the hash covers its root
+	//the value is a new fork, so its root stays live when value changes and is collected (see p1 CollectGarbage)
+	b.Value = value.Clone()
 	//!!!create a header without hash first, then set hash(call hashBlock method)
-	b.Header.Hash = b.hashBlock()
-	b.Value = value
+	b.Header.Hash, _ = b.hashBlock()
+}
+
+
+/**
+Description: Set the difficulty of the block, and hash it again: the hash covers the difficulty.
+A block with a proof of work must be mined after this (see Miner).
+Argument: difficulty (uint64)
+Return: error "invalid_hash: unknown header version"
+ */
+func (b *Block) SetDifficulty(difficulty uint64) error {
+	b.Header.Difficulty = difficulty
+	hash, err := b.hashBlock()
+	if err != nil {
+		return err
+	}
+	b.Header.Hash = hash
+	return nil
 }
 
 
@@ -84,7 +116,7 @@ Description: This function takes a string that represents the JSON value of a bl
 and decodes the input string back to a block instance.
 Note that you have to reconstruct an MPT from the JSON string, and use that MPT as the block's value.
 Argument: a string of JSON format
-Return value: a block instance, error
+Return value: a block instance, error (the trie errors of p1, like *p1.CorruptNodeError, are returned as they are)
  */
 func DecodeFromJson(jsonString string) (Block, error) {
 	//fmt.Println(jsonString)
@@ -93,25 +125,29 @@ func DecodeFromJson(jsonString string) (Block, error) {
 	err := json.Unmarshal([]byte(jsonString), &blockJson)
 	if err != nil {
 		fmt.Println("Umarshal failed:", err)
+		return Block{}, err
 	}
-	block := blockJsonToBlock(blockJson)
-
-	return block, err
+	return blockJsonToBlock(blockJson)
 }
 
 /**
 Description: This function convert BlockJson struct to a block instance。
-Use mpt paris to create mpt, then create block.
+Use mpt paris to create mpt in one batch, then create block.
 Argument: BlockJson
-Return value: Block
+Return value: Block, error of the trie build (*p1.InvalidKeyError)
  */
-func blockJsonToBlock(blockJson BlockJson) Block {
+func blockJsonToBlock(blockJson BlockJson) (Block, error) {
 	mpt := p1.MerklePatriciaTrie{}
 	mpt.Initial()
 
 	mptMap :=  blockJson.MPT
+	pairs := make([]p1.KeyValuePair, 0, len(mptMap))
 	for k,v := range mptMap{
-		mpt.Insert(k, v)
+		pairs = append(pairs, p1.KeyValuePair{Key: k, Value: v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	if err := mpt.BuildFromSorted(pairs); err != nil {
+		return Block{}, err
 	}
 
 	height := blockJson.Height
@@ -120,10 +156,44 @@ func blockJsonToBlock(blockJson BlockJson) Block {
 	parentHash := blockJson.ParentHash
 	size := blockJson.Size
 
-	header := Header{height, timeStamp, hash, parentHash, size}
+	header := Header{height, timeStamp, hash, parentHash, size, blockJson.Nonce, blockJson.Difficulty, blockJson.Version}
 	block := Block{header, mpt}
 
-	return block
+	return block, nil
+}
+
+/**
+Description: Rebuild a block from its header and the byte array of its value (see p1.MptToByteArray).
+Every node of the value is checked against its hash, and the length of data must be the size of the header.
+Argument: header (Header), data ([]byte)
+Return value: Block, error (*p1.CorruptNodeError or *p1.MissingNodeError if data is broken, "invalid_block: wrong size")
+ */
+func BlockFromByteArray(header Header, data []byte) (Block, error) {
+	mpt, err := p1.MptFromByteArray(data)
+	if err != nil {
+		return Block{}, err
+	}
+	if int(header.Size) != len(data) {
+		return Block{}, errors.New("invalid_block: wrong size")
+	}
+	return Block{header, mpt}, nil
+}
+
+/**
+Description: Open a block whose value is stored in store, for example a p1.FileNodeStore, at root.
+Every node of the value is read and checked against its hash.
+Argument: header (Header), store (p1.NodeStore), root (string)
+Return value: Block, error (*p1.MissingNodeError if a node is not in store, *p1.CorruptNodeError if a node is broken)
+ */
+func OpenBlock(header Header, store p1.NodeStore, root string) (Block, error) {
+	mpt, err := p1.OpenMpt(store, root)
+	if err != nil {
+		return Block{}, err
+	}
+	if err := mpt.Verify().Err(); err != nil {
+		return Block{}, err
+	}
+	return Block{header, mpt}, nil
 }
 
 /**
@@ -176,20 +246,50 @@ func (b *Block) blockToBlockJson() BlockJson {
 	blockJson.Height = b.Header.Height
 	blockJson.ParentHash = b.Header.ParentHash
 	blockJson.Size = b.Header.Size
+	blockJson.Nonce = b.Header.Nonce
+	blockJson.Difficulty = b.Header.Difficulty
+	blockJson.Version = b.Header.Version
 	blockJson.MPT = mptMap
 
 	return blockJson
 }
 
 /**
-Block’s hash is the SHA3-256 encoded value of this string(note that you have to follow this specific order):
-hash_str := string(b.Header.Height) + string(b.Header.Timestamp) + b.Header.ParentHash + b.Value.Root + string(b.Header.Size)
-Return: string
+Block’s hash is the SHA3-256 encoded value of the preimage of its header version (see EncodeHeader).
+Return: string, error "invalid_hash: unknown header version"
+ */
+func (b *Block) hashBlock() (string, error) {
+	return hashHeader(b.Header, b.Value.GetRoot())
+}
+
+/**
+Description: The hash of a header, with root the root of the block value. The miner calls it for every nonce.
+Argument: header (Header), root (string)
+Return: string, error
  */
-func (b *Block) hashBlock() string {
-	hashStr := string(b.Header.Height) + string(b.Header.Timestamp) + b.Header.ParentHash + b.Value.GetRoot() + string(b.Header.Size)
-	sum := sha3.Sum256([]byte(hashStr))
-	return hex.EncodeToString(sum[:])
+func hashHeader(header Header, root string) (string, error) {
+	preimage, err := encodeHeader(header, root)
+	if err != nil {
+		return "", err
+	}
+	sum := sha3.Sum256(preimage)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+/**
+Description: Check that the hash of the block is the hash of its header, in the scheme of its version.
+The legacy and the canonical blocks are checked side by side.
+Return: error "invalid_hash: ..."
+ */
+func (b *Block) VerifyHash() error {
+	hash, err := b.hashBlock()
+	if err != nil {
+		return err
+	}
+	if hash != b.Header.Hash {
+		return errors.New("invalid_hash: wrong hash")
+	}
+	return nil
 }
 
 
@@ -2,8 +2,11 @@ package p2
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	//"../p1"
 )
 
@@ -14,10 +17,19 @@ Each blockchain must contain two fields described below.Don't change the name or
 This is a map which maps a block height to a list of blocks. The value is a list so that it can handle the forks.
 (2) Length: int32
 Length equals to the highest block height.
+(3) RequirePoW: bool
+If it is set, Insert rejects the blocks without a valid proof of work (see VerifyPoW).
+(4) Retarget: DifficultyAlgorithm
+If it is set, Insert rejects the blocks whose difficulty is not the one computed from their ancestors,
+or whose hash doesn't cover their header (see VerifyHash).
+Without RequirePoW, anyone can recompute the hash, so the difficulty is checked but not authenticated:
+only the proof of work shows that the work of the difficulty was done.
  */
 type BlockChain struct {
 	Chain map[int32][]Block
 	Length int32
+	RequirePoW bool
+	Retarget DifficultyAlgorithm
 }
 
 /**
@@ -26,7 +38,7 @@ Return type: BlockChain
  */
 func NewBlockChain() BlockChain{
 	//create a blockchain structure
-	return BlockChain{make(map[int32][]Block), 0}
+	return BlockChain{Chain: make(map[int32][]Block), Length: 0}
 }
 
 
@@ -49,9 +61,32 @@ func (bc *BlockChain) Get(height int32) []Block {
 Description: This function takes a block as the argument, use its height to find the corresponding list in blockchain's Chain map.
 If the list has already contained that block's hash, ignore it because we don't store duplicate blocks;
 if not, insert the block into the list.
+If Retarget is set, the block must have the difficulty of ExpectedDifficulty, and a valid hash.
+If RequirePoW is set, the block must have a valid proof of work.
 Argument: block
+Return: error "invalid_difficulty: ...", "invalid_hash: ..." or "invalid_pow: ..." if the block is rejected.
+Compatibility: Insert used to return nothing. A chain without RequirePoW and Retarget never rejects a block,
+so the old callers keep their behavior, but the new callers must check the error.
  */
-func (bc *BlockChain) Insert(block Block) {
+func (bc *BlockChain) Insert(block Block) error {
+	if bc.Retarget != nil {
+		//the difficulty is only bound to the block by its hash
+		if err := block.VerifyHash(); err != nil {
+			return err
+		}
+		difficulty, err := bc.ExpectedDifficulty(block)
+		if err != nil {
+			return err
+		}
+		if block.Header.Difficulty != difficulty {
+			return errors.New("invalid_difficulty: expected " + strconv.FormatUint(difficulty, 10))
+		}
+	}
+	if bc.RequirePoW {
+		if err := block.VerifyPoW(); err != nil {
+			return err
+		}
+	}
 	height := block.Header.Height
 	//blockList := bc.Chain[height]
 	blockList := bc.Get(height)
@@ -79,10 +114,45 @@ func (bc *BlockChain) Insert(block Block) {
 	if block.Header.Height > bc.Length {
 		bc.Length = block.Header.Height
 	}
+	return nil
+}
+
+/**
+Description: Find the parent of a block, the block of height - 1 whose hash is the parent hash.
+Argument: block
+Return type: Block, bool (false if the parent is not in the chain)
+ */
+func (bc *BlockChain) GetParent(block Block) (Block, bool) {
+	for _, parent := range bc.Chain[block.Header.Height-1] {
+		if parent.Header.Hash == block.Header.ParentHash {
+			return parent, true
+		}
+	}
+	return Block{}, false
+}
+
+/**
+Description: The difficulty that Retarget computes for a block, from its height and its parent.
+A miner sets it in the header before mining.
+Argument: block
+Return type: uint64, error "invalid_difficulty: ..." if the parent is not in the chain.
+ */
+func (bc *BlockChain) ExpectedDifficulty(block Block) (uint64, error) {
+	if bc.Retarget == nil {
+		return block.Header.Difficulty, nil
+	}
+	if block.Header.Height <= 1 {
+		return bc.Retarget.NextDifficulty(bc, nil)
+	}
+	parent, ok := bc.GetParent(block)
+	if !ok {
+		return 0, errors.New("invalid_difficulty: unknown parent")
+	}
+	return bc.Retarget.NextDifficulty(bc, &parent)
 }
 
 /**
-Description: This function iterates over all the blocks,
+Description: This function iterates over all the blocks in the order of height,
 generate blocks' JsonString by the function you implemented previously,
 and return the list of those JsonStrings.
 Return type: string，error
@@ -90,9 +160,14 @@ Return type: string，error
 func (bc *BlockChain) EncodeToJson() (string, error) {
 
 	var jsonArray []BlockJson
-	//k: height,
-	for _,blocklist := range bc.Chain{
-		for _,block := range blocklist {
+	//sort the heights, so the same chain is always encoded to the same string
+	var heights []int
+	for height := range bc.Chain {
+		heights = append(heights, int(height))
+	}
+	sort.Ints(heights)
+	for _, height := range heights {
+		for _,block := range bc.Chain[int32(height)] {
 			//fmt.Println("root:", block.Value.GetRoot())
 			jsonStruct := block.blockToBlockJson()
 			jsonArray = append(jsonArray, jsonStruct)
@@ -124,10 +199,15 @@ func DecodeJsonToBlockChain(jsonString string) (BlockChain, error) {
 
 	bc := NewBlockChain()
 	for _,blockJson := range jsonArray {
-		block := blockJsonToBlock(blockJson)
+		block, err := blockJsonToBlock(blockJson)
+		if err != nil {
+			return bc, err
+		}
 		//insert block
 		//fmt.Println("block:", block)
-		bc.Insert(block)
+		if err := bc.Insert(block); err != nil {
+			return bc, err
+		}
 	}
 
 	return bc, err
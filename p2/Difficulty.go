@@ -0,0 +1,173 @@
+package p2
+
+import (
+	"errors"
+	"math/big"
+)
+
+/**
+DifficultyAlgorithm computes the difficulty of a block from the timestamps of its ancestors.
+NextDifficulty returns the difficulty of the child of parent, parent is nil for the first block (height 1).
+The ancestors of parent are found with bc.GetParent.
+ */
+type DifficultyAlgorithm interface {
+	NextDifficulty(bc *BlockChain, parent *Block) (uint64, error)
+}
+
+/**
+BitcoinRetarget keeps the difficulty for Interval blocks, then scales it by the ratio of the expected time
+of the last Interval blocks to their observed time. The ratio is clamped to [1/4, 4].
+The block times are random, so a short interval makes the difficulty too high on average
+(by about (Interval - 1) / (Interval - 2)): use at least 20 blocks.
+(1) Initial: the difficulty of the first block
+(2) Interval: the number of blocks between two retargets, at least 2
+(3) Spacing: the target time between two blocks, in seconds
+ */
+type BitcoinRetarget struct {
+	Initial  uint64
+	Interval int32
+	Spacing  int64
+}
+
+/**
+Create a Bitcoin-style retarget
+Return type: *BitcoinRetarget, error "invalid_retarget: ..." if a parameter is out of range
+ */
+func NewBitcoinRetarget(initial uint64, interval int32, spacing int64) (*BitcoinRetarget, error) {
+	retarget := &BitcoinRetarget{Initial: initial, Interval: interval, Spacing: spacing}
+	if err := retarget.check(); err != nil {
+		return nil, err
+	}
+	return retarget, nil
+}
+
+/**
+Description: Check the parameters, a retarget can also be created without NewBitcoinRetarget.
+Return: error "invalid_retarget: ..."
+ */
+func (retarget *BitcoinRetarget) check() error {
+	switch {
+	case retarget.Initial == 0:
+		return errors.New("invalid_retarget: initial difficulty 0")
+	case retarget.Interval < 2:
+		return errors.New("invalid_retarget: interval below 2")
+	case retarget.Spacing <= 0:
+		return errors.New("invalid_retarget: spacing not positive")
+	}
+	return nil
+}
+
+func (retarget *BitcoinRetarget) NextDifficulty(bc *BlockChain, parent *Block) (uint64, error) {
+	if err := retarget.check(); err != nil {
+		return 0, err
+	}
+	if parent == nil {
+		return retarget.Initial, nil
+	}
+	if parent.Header.Height%retarget.Interval != 0 {
+		return parent.Header.Difficulty, nil
+	}
+	//the first block of the window
+	first := *parent
+	for i := int32(1); i < retarget.Interval; i++ {
+		ancestor, ok := bc.GetParent(first)
+		if !ok {
+			return 0, errors.New("invalid_difficulty: missing ancestor")
+		}
+		first = ancestor
+	}
+	expected := int64(retarget.Interval-1) * retarget.Spacing
+	observed := clampInt64(parent.Header.Timestamp-first.Header.Timestamp, expected/4, expected*4)
+	return scaleDifficulty(parent.Header.Difficulty, expected, observed), nil
+}
+
+/**
+EmaRetarget changes the difficulty at every block, by an exponential moving average of the block times:
+next = difficulty * (1 + (Spacing - time) / (Spacing * Window))
+where time is the time between the parent and its parent, clamped to [0, 6 * Spacing].
+(1) Initial: the difficulty of the first block
+(2) Window: the smoothing of the average in blocks, at least 6
+(3) Spacing: the target time between two blocks, in seconds
+ */
+type EmaRetarget struct {
+	Initial uint64
+	Window  int64
+	Spacing int64
+}
+
+/**
+Create an exponential moving average retarget
+Return type: *EmaRetarget, error "invalid_retarget: ..." if a parameter is out of range
+ */
+func NewEmaRetarget(initial uint64, window int64, spacing int64) (*EmaRetarget, error) {
+	retarget := &EmaRetarget{Initial: initial, Window: window, Spacing: spacing}
+	if err := retarget.check(); err != nil {
+		return nil, err
+	}
+	return retarget, nil
+}
+
+/**
+Description: Check the parameters. With a window below 6, a slow block (6 * Spacing) would make the difficulty negative.
+Return: error "invalid_retarget: ..."
+ */
+func (retarget *EmaRetarget) check() error {
+	switch {
+	case retarget.Initial == 0:
+		return errors.New("invalid_retarget: initial difficulty 0")
+	case retarget.Window < 6:
+		return errors.New("invalid_retarget: window below 6")
+	case retarget.Spacing <= 0:
+		return errors.New("invalid_retarget: spacing not positive")
+	}
+	return nil
+}
+
+func (retarget *EmaRetarget) NextDifficulty(bc *BlockChain, parent *Block) (uint64, error) {
+	if err := retarget.check(); err != nil {
+		return 0, err
+	}
+	if parent == nil {
+		return retarget.Initial, nil
+	}
+	grandparent, ok := bc.GetParent(*parent)
+	if !ok {
+		//the first block has no block time
+		return parent.Header.Difficulty, nil
+	}
+	time := clampInt64(parent.Header.Timestamp-grandparent.Header.Timestamp, 0, 6*retarget.Spacing)
+	expected := retarget.Spacing * retarget.Window
+	return scaleDifficulty(parent.Header.Difficulty, expected+retarget.Spacing-time, expected), nil
+}
+
+/**
+Description: difficulty * numerator / denominator without overflow, at least 1 and at most the largest uint64.
+The checked parameters of the retargets make numerator and denominator positive, 1 is returned otherwise.
+Argument: difficulty (uint64), numerator (int64), denominator (int64)
+Return: uint64
+ */
+func scaleDifficulty(difficulty uint64, numerator int64, denominator int64) uint64 {
+	if numerator <= 0 || denominator <= 0 {
+		return 1
+	}
+	scaled := new(big.Int).SetUint64(difficulty)
+	scaled.Mul(scaled, big.NewInt(numerator))
+	scaled.Div(scaled, big.NewInt(denominator))
+	if !scaled.IsUint64() {
+		return ^uint64(0)
+	}
+	if scaled.Sign() == 0 {
+		return 1
+	}
+	return scaled.Uint64()
+}
+
+func clampInt64(value int64, min int64, max int64) int64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package p2
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+)
+
+/**
+Versions of the block hash preimage (Header.Version).
+(1) LegacyHeaderVersion: the first scheme, the integers are converted to one Unicode rune each,
+so most timestamps become U+FFFD and two headers can have the same preimage. The block was hashed
+before its value was set, so the preimage has an empty root: the hash doesn't cover the value.
+It is kept to check old blocks.
+Compatibility: the blocks of the first version keep their hashes. NewBlock creates canonical blocks, so a new block
+doesn't have the hash the first version gave it. The version 0 blocks hashed with the root of the value in the
+preimage (by the first versioned code) don't verify anymore: create them again with NewBlock.
+(2) CanonicalHeaderVersion: fixed-width big-endian integers and length-prefixed strings, see EncodeHeader.
+ */
+const (
+	LegacyHeaderVersion    uint32 = 0
+	CanonicalHeaderVersion uint32 = 1
+)
+
+/**
+Description:
+The hash preimage of the block, in the scheme of its header version. The canonical encoding is:
+version (4 bytes) | height (4) | timestamp (8) | parent hash (4-byte length, bytes) |
+root of the value (4-byte length, bytes) | size (4) | nonce (8) | difficulty (8)
+Return: []byte, error "invalid_hash: unknown header version"
+ */
+func (b *Block) EncodeHeader() ([]byte, error) {
+	return encodeHeader(b.Header, b.Value.GetRoot())
+}
+
+/**
+Description: The hash preimage of a header, with root the root of the block value (not used by the legacy version).
+Argument: header (Header), root (string)
+Return: []byte, error
+ */
+func encodeHeader(header Header, root string) ([]byte, error) {
+	switch header.Version {
+	case LegacyHeaderVersion:
+		return []byte(legacyPreimage(header)), nil
+	case CanonicalHeaderVersion:
+		data := make([]byte, 0, 48+len(header.ParentHash)+len(root))
+		data = appendUint32(data, header.Version)
+		data = appendUint32(data, uint32(header.Height))
+		data = appendUint64(data, uint64(header.Timestamp))
+		data = appendString(data, header.ParentHash)
+		data = appendString(data, root)
+		data = appendUint32(data, uint32(header.Size))
+		data = appendUint64(data, header.Nonce)
+		data = appendUint64(data, header.Difficulty)
+		return data, nil
+	}
+	return nil, errors.New("invalid_hash: unknown header version " + strconv.FormatUint(uint64(header.Version), 10))
+}
+
+/**
+Description:
+The legacy preimage: string(Height) + string(Timestamp) + ParentHash + string(Size),
+with "|" + Nonce + "|" + Difficulty in decimal at the end for a block with a difficulty.
+The root of the value was always empty when the first version hashed a block, so it isn't in the preimage.
+Argument: header (Header)
+Return: string
+ */
+func legacyPreimage(header Header) string {
+	hashStr := legacyRuneString(int64(header.Height)) + legacyRuneString(header.Timestamp) +
+		header.ParentHash + legacyRuneString(int64(header.Size))
+	if header.Difficulty != 0 {
+		hashStr += "|" + strconv.FormatUint(header.Nonce, 10) + "|" + strconv.FormatUint(header.Difficulty, 10)
+	}
+	return hashStr
+}
+
+/**
+Description:
+The string of the legacy integer-to-string conversion string(value): the UTF-8 encoding of the rune value,
+or U+FFFD if value is not a valid code point. string(rune(value)) alone would truncate value to 32 bits first.
+Argument: value (int64)
+Return: string
+ */
+func legacyRuneString(value int64) string {
+	if value < 0 || value > utf8.MaxRune {
+		return string(utf8.RuneError)
+	}
+	return string(rune(value))
+}
+
+func appendUint32(data []byte, value uint32) []byte {
+	var buffer [4]byte
+	binary.BigEndian.PutUint32(buffer[:], value)
+	return append(data, buffer[:]...)
+}
+
+func appendUint64(data []byte, value uint64) []byte {
+	var buffer [8]byte
+	binary.BigEndian.PutUint64(buffer[:], value)
+	return append(data, buffer[:]...)
+}
+
+func appendString(data []byte, value string) []byte {
+	return append(appendUint32(data, uint32(len(value))), value...)
+}
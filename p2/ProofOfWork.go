@@ -0,0 +1,136 @@
+package p2
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"runtime"
+	"sync"
+)
+
+/**
+Proof of work: the hash of a block, read as a 256-bit big-endian number, must be below
+target = 2^256 / Difficulty. On average a miner tries Difficulty nonces to find a block.
+A block with Difficulty 0 has no proof of work.
+ */
+
+/**
+Description: The target of a difficulty, 2^256 / difficulty.
+Argument: difficulty (uint64), not 0
+Return: *big.Int
+ */
+func powTarget(difficulty uint64) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), 256)
+	return target.Div(target, new(big.Int).SetUint64(difficulty))
+}
+
+/**
+Description: Whether a hash (hex string) is below target.
+Argument: hash (string), target (*big.Int)
+Return: bool
+ */
+func meetsTarget(hash string, target *big.Int) bool {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 32 {
+		return false
+	}
+	return new(big.Int).SetBytes(raw).Cmp(target) < 0
+}
+
+/**
+Description: Check the proof of work of the block: the hash is the hash of the block (see VerifyHash),
+and it is below the target.
+Return: error "invalid_hash: ..." or "invalid_pow: ..." if the check fails.
+ */
+func (b *Block) VerifyPoW() error {
+	if b.Header.Difficulty == 0 {
+		return errors.New("invalid_pow: no difficulty")
+	}
+	if err := b.VerifyHash(); err != nil {
+		return err
+	}
+	if !meetsTarget(b.Header.Hash, powTarget(b.Header.Difficulty)) {
+		return errors.New("invalid_pow: hash above target")
+	}
+	return nil
+}
+
+/**
+Miner searches the nonce of a block with Workers goroutines, worker i tries the nonces Nonce+i, Nonce+i+Workers, ...
+Example:
+block := p2.NewBlock(height, timeStamp, parentHash, mpt)
+block.SetDifficulty(1 << 16)
+err := p2.NewMiner(4).Mine(ctx, &block)
+ */
+type Miner struct {
+	Workers int
+}
+
+/**
+Create a miner with workers goroutines, runtime.NumCPU() if workers <= 0
+Return type: *Miner
+ */
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{Workers: workers}
+}
+
+/**
+Description:
+Mine searches a nonce for which the hash of the block is below the target of its difficulty,
+starting from block.Header.Nonce. The nonce and the hash of the block are set when one is found.
+The search stops when ctx is done, the block is then unchanged.
+Argument: ctx (context.Context), block (*Block)
+Return: error "invalid_pow: no difficulty", "invalid_hash: unknown header version", or the error of ctx
+ */
+func (miner *Miner) Mine(ctx context.Context, block *Block) error {
+	if block.Header.Difficulty == 0 {
+		return errors.New("invalid_pow: no difficulty")
+	}
+	workers := miner.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	root := block.Value.GetRoot()
+	if _, err := hashHeader(block.Header, root); err != nil {
+		return err
+	}
+	target := powTarget(block.Header.Difficulty)
+	search, stop := context.WithCancel(ctx)
+	defer stop()
+	found := make(chan Header, workers)
+	var group sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		header := block.Header
+		header.Nonce += uint64(i)
+		group.Add(1)
+		go func(header Header) {
+			defer group.Done()
+			for tries := 0; ; tries++ {
+				//check the context from time to time, not for every nonce
+				if tries%1024 == 0 && search.Err() != nil {
+					return
+				}
+				header.Hash, _ = hashHeader(header, root)
+				if meetsTarget(header.Hash, target) {
+					found <- header
+					stop()
+					return
+				}
+				header.Nonce += uint64(workers)
+			}
+		}(header)
+	}
+	group.Wait()
+	select {
+	case header := <-found:
+		block.Header.Nonce = header.Nonce
+		block.Header.Hash = header.Hash
+		return nil
+	default:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"../p1"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func batch_pairs(n int) []p1.KeyValuePair {
+	pairs := make([]p1.KeyValuePair, n)
+	for i := range pairs {
+		pairs[i] = p1.KeyValuePair{Key: "account:" + strconv.Itoa(i), Value: "balance " + strconv.Itoa(i*7)}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs
+}
+
+func TestBuildFromSorted(t *testing.T) {
+	pairs := batch_pairs(500)
+	pairs = append(pairs, p1.KeyValuePair{Key: "account", Value: "prefix of every key"})
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	inserted := p1.MerklePatriciaTrie{}
+	inserted.Initial()
+	for _, pair := range pairs {
+		inserted.Insert(pair.Key, pair.Value)
+	}
+	built := p1.MerklePatriciaTrie{}
+	built.Initial()
+	if err := built.BuildFromSorted(pairs); err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestBuildFromSorted root", built.GetRoot(), inserted.GetRoot(), t)
+	if report := built.CollectGarbage(); report.NodesReclaimed != 0 {
+		fmt.Println("TestBuildFromSorted: intermediate nodes created", report.NodesReclaimed)
+		t.Fail()
+	}
+
+	pairs[0], pairs[1] = pairs[1], pairs[0]
+	if err := built.BuildFromSorted(pairs); err == nil {
+		fmt.Println("TestBuildFromSorted: unsorted pairs accepted")
+		t.Fail()
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	mpt.Insert("charles", "old")
+	mpt.InsertBatch([]p1.KeyValuePair{
+		{Key: "charles", Value: "ge"},
+		{Key: "a", Value: "1"},
+		{Key: "ab", Value: "first"},
+		{Key: "ab", Value: "2"},
+	})
+
+	expected := map[string]string{"hello": "world", "charles": "ge", "a": "1", "ab": "2"}
+	if !reflect.DeepEqual(mpt.GetMptMap(mpt.GetRoot(), []uint8{}), expected) {
+		fmt.Println("TestInsertBatch:", mpt.GetMptMap(mpt.GetRoot(), []uint8{}))
+		t.Fail()
+	}
+	reference := p1.MerklePatriciaTrie{}
+	reference.Initial()
+	for k, v := range expected {
+		reference.Insert(k, v)
+	}
+	check_eq("TestInsertBatch root", mpt.GetRoot(), reference.GetRoot(), t)
+}
+
+func TestInsertBatchRandom(t *testing.T) {
+	//short keys over a small alphabet: prefixes, shared extensions and branch values
+	rng := rand.New(rand.NewSource(7))
+	random_key := func() string {
+		key := make([]byte, rng.Intn(4))
+		for i := range key {
+			key[i] = "ab\x00q"[rng.Intn(4)]
+		}
+		return string(key)
+	}
+	for round := 0; round < 200; round++ {
+		mpt := p1.MerklePatriciaTrie{}
+		mpt.Initial()
+		reference := p1.MerklePatriciaTrie{}
+		reference.Initial()
+		for i := rng.Intn(20); i > 0; i-- {
+			key, value := random_key(), strconv.Itoa(rng.Intn(100))
+			mpt.Insert(key, value)
+			reference.Insert(key, value)
+		}
+		var pairs []p1.KeyValuePair
+		for i := rng.Intn(20); i > 0; i-- {
+			pair := p1.KeyValuePair{Key: random_key(), Value: strconv.Itoa(rng.Intn(100))}
+			pairs = append(pairs, pair)
+			reference.Insert(pair.Key, pair.Value)
+		}
+		if err := mpt.InsertBatch(pairs); err != nil {
+			t.Fatal(err)
+		}
+		if mpt.GetRoot() != reference.GetRoot() {
+			fmt.Println("TestInsertBatchRandom round", round, pairs)
+			t.FailNow()
+		}
+	}
+}
+
+func TestInsertBatchSubtrees(t *testing.T) {
+	store := &counting_store{MemoryNodeStore: p1.NewMemoryNodeStore()}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.BuildFromSorted(batch_pairs(1000))
+	store.gets = 0
+	mpt.InsertBatch([]p1.KeyValuePair{{Key: "account:5", Value: "new"}, {Key: "account:77x", Value: "new"}})
+	//only the nodes of the two paths are read
+	if store.gets > 40 {
+		fmt.Println("TestInsertBatchSubtrees: nodes read", store.gets)
+		t.Fail()
+	}
+	v, _ := mpt.Get("account:77x")
+	check_eq("TestInsertBatchSubtrees", v, "new", t)
+
+	//a missing node of a path is an error, and the trie is not changed
+	root := mpt.GetRoot()
+	for _, hash := range store.Hashes() {
+		if hash != root {
+			store.Delete(hash)
+		}
+	}
+	var missing *p1.MissingNodeError
+	if err := mpt.InsertBatch([]p1.KeyValuePair{{Key: "account:5", Value: "lost"}}); !errors.As(err, &missing) {
+		fmt.Println("TestInsertBatchSubtrees missing:", err)
+		t.Fail()
+	}
+	check_eq("TestInsertBatchSubtrees root", mpt.GetRoot(), root, t)
+}
+
+func benchmark_insert(b *testing.B, n int) {
+	pairs := batch_pairs(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mpt := p1.MerklePatriciaTrie{}
+		mpt.Initial()
+		for _, pair := range pairs {
+			mpt.Insert(pair.Key, pair.Value)
+		}
+	}
+}
+
+func benchmark_build(b *testing.B, n int) {
+	pairs := batch_pairs(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mpt := p1.MerklePatriciaTrie{}
+		mpt.Initial()
+		mpt.BuildFromSorted(pairs)
+	}
+}
+
+func BenchmarkInsert10k(b *testing.B)          { benchmark_insert(b, 10000) }
+func BenchmarkBuildFromSorted10k(b *testing.B) { benchmark_build(b, 10000) }
+func BenchmarkInsert1M(b *testing.B)           { benchmark_insert(b, 1000000) }
+func BenchmarkBuildFromSorted1M(b *testing.B)  { benchmark_build(b, 1000000) }
@@ -88,8 +88,10 @@ func Test(t *testing.T){
 	b2 := p2.NewBlock(1, 1234567890, b1.Header.Hash, mpt)
 	b3 := p2.NewBlock(1, 1234567890, b2.Header.Hash, mpt)
 	bc := p2.NewBlockChain()
-	bc.Insert(b1)
-	bc.Insert(b2)
-	bc.Insert(b3)
+	for _, block := range []p2.Block{b1, b2, b3} {
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+	}
 	fmt.Println(bc.EncodeToJson())
 }
\ No newline at end of file
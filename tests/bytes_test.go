@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"../p1"
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBytesKeysAndValues(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	pairs := []struct{ key, value []byte }{
+		{[]byte{}, []byte("value of the empty key")},
+		{[]byte{0}, []byte{}},
+		{[]byte{0, 0}, []byte{0, 1, 0}},
+		{[]byte{0, 0, 7}, []byte("leaf below a branch with the empty value")},
+		{[]byte("pubkey"), []byte{0xff, 0, 0xfe}},
+	}
+	for _, pair := range pairs {
+		mpt.InsertBytes(pair.key, pair.value)
+	}
+	for _, pair := range pairs {
+		value, err := mpt.GetBytes(pair.key)
+		if err != nil || !bytes.Equal(value, pair.value) {
+			fmt.Println("TestBytesKeysAndValues: wrong value for", pair.key, value, err)
+			t.Fail()
+		}
+	}
+	if _, err := mpt.GetBytes([]byte{0, 1}); err == nil {
+		fmt.Println("TestBytesKeysAndValues: missing key found")
+		t.Fail()
+	}
+
+	//the empty value is kept when the branch above it changes
+	mpt.DeleteBytes([]byte{0, 0, 7})
+	value, err := mpt.GetBytes([]byte{0})
+	if err != nil || value == nil || len(value) != 0 {
+		fmt.Println("TestBytesKeysAndValues: empty value lost", value, err)
+		t.Fail()
+	}
+
+	//the string API is a wrapper
+	v, err := mpt.Get("")
+	check_eq("TestBytesKeysAndValues empty key", v, "value of the empty key", t)
+	expected := map[string]string{"": "value of the empty key", "\x00": "", "\x00\x00": "\x00\x01\x00", "pubkey": "\xff\x00\xfe"}
+	if !reflect.DeepEqual(mpt.GetMptMap(mpt.GetRoot(), []uint8{}), expected) {
+		fmt.Println("TestBytesKeysAndValues: wrong map", mpt.GetMptMap(mpt.GetRoot(), []uint8{}))
+		t.Fail()
+	}
+	if err := mpt.DeleteBytes([]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mpt.Get(""); err == nil {
+		fmt.Println("TestBytesKeysAndValues: deleted empty key found")
+		t.Fail()
+	}
+
+	empty := p1.MerklePatriciaTrie{}
+	empty.Initial()
+	if err := empty.DeleteBytes([]byte("a")); err == nil {
+		fmt.Println("TestBytesKeysAndValues: delete in an empty trie")
+		t.Fail()
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+/**
+A store counting the calls to the slower store.
+ */
+type counting_store struct {
+	*p1.MemoryNodeStore
+	gets int
+	puts int
+}
+
+func (store *counting_store) Get(hash string) (p1.Node, bool) {
+	store.gets++
+	return store.MemoryNodeStore.Get(hash)
+}
+
+func (store *counting_store) Put(hash string, node p1.Node) {
+	store.puts++
+	store.MemoryNodeStore.Put(hash, node)
+}
+
+func TestCachedNodeStore(t *testing.T) {
+	backing := &counting_store{MemoryNodeStore: p1.NewMemoryNodeStore()}
+	cache := p1.NewCachedNodeStore(backing, 1<<20)
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(cache)
+	for i := 0; i < 100; i++ {
+		mpt.Insert("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+	//nothing written before the commit
+	check_eq("TestCachedNodeStore puts before commit", strconv.Itoa(backing.puts), "0", t)
+	dirty := cache.Stats().Dirty
+	root, err := mpt.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestCachedNodeStore puts", strconv.Itoa(backing.puts), strconv.Itoa(dirty), t)
+	check_eq("TestCachedNodeStore dirty after commit", strconv.Itoa(cache.Stats().Dirty), "0", t)
+
+	//reads hit the cache
+	before := cache.Stats()
+	v, _ := mpt.Get("key42")
+	check_eq("TestCachedNodeStore get", v, "value42", t)
+	after := cache.Stats()
+	if after.Hits <= before.Hits || after.Misses != before.Misses || backing.gets != 0 {
+		fmt.Println("TestCachedNodeStore: reads missed the cache", before, after, backing.gets)
+		t.Fail()
+	}
+
+	//a trie reopened on the slower store has every committed node
+	reopened, err := p1.OpenMpt(backing, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ = reopened.Get("key99")
+	check_eq("TestCachedNodeStore reopened", v, "value99", t)
+}
+
+func TestCachedNodeStoreBudget(t *testing.T) {
+	backing := &counting_store{MemoryNodeStore: p1.NewMemoryNodeStore()}
+	cache := p1.NewCachedNodeStore(backing, 2000)
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(cache)
+	for i := 0; i < 200; i++ {
+		mpt.Insert("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+	stats := cache.Stats()
+	if stats.Bytes > 2000 || backing.puts == 0 {
+		fmt.Println("TestCachedNodeStoreBudget: budget not respected", stats, backing.puts)
+		t.Fail()
+	}
+	//evicted dirty nodes were written, so nothing is lost
+	for i := 0; i < 200; i++ {
+		v, _ := mpt.Get("key" + strconv.Itoa(i))
+		check_eq("TestCachedNodeStoreBudget get", v, "value"+strconv.Itoa(i), t)
+	}
+	if cache.Stats().Misses == 0 {
+		fmt.Println("TestCachedNodeStoreBudget: no miss with a small cache")
+		t.Fail()
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/**
+These tests are meant to be run with the race detector:
+go test -race ./tests/
+ */
+
+func concurrency_blocks() []p2.Block {
+	var blocks []p2.Block
+	parentHash := "genesis"
+	shared := p1.MerklePatriciaTrie{}
+	shared.Initial()
+	shared.Insert("shared", "state")
+	for i := 0; i < 50; i++ {
+		mpt := shared
+		if i%2 == 0 {
+			//every other block has its own trie
+			mpt = p1.MerklePatriciaTrie{}
+			mpt.Initial()
+			for j := 0; j < 20; j++ {
+				mpt.Insert("key"+strconv.Itoa(i)+"_"+strconv.Itoa(j), "value"+strconv.Itoa(j))
+			}
+		}
+		block := p2.NewBlock(int32(i+1), 1551025401, parentHash, mpt)
+		parentHash = block.Header.Hash
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestConcurrentBlockEncode(t *testing.T) {
+	blocks := concurrency_blocks()
+	expected := make([]string, len(blocks))
+	for i := range blocks {
+		expected[i], _ = blocks[i].EncodeToJson()
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range blocks {
+				block := blocks[i]
+				real, err := block.EncodeToJson()
+				lock.Lock()
+				if err != nil || real != expected[i] {
+					fmt.Println("TestConcurrentBlockEncode: block", i, err)
+					t.Fail()
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentBlockChainEncode(t *testing.T) {
+	bc := p2.NewBlockChain()
+	for _, block := range concurrency_blocks() {
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, _ := bc.EncodeToJson()
+
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for worker := range results {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			results[worker], _ = bc.EncodeToJson()
+		}(worker)
+	}
+	wg.Wait()
+	for _, real := range results {
+		check_eq("TestConcurrentBlockChainEncode", real, expected, t)
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			mpt.Insert("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+		}
+	}()
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				mpt.Get("hello")
+				mpt.GetMptMap(mpt.GetRoot(), []uint8{})
+				_ = mpt.String()
+			}
+		}()
+	}
+	wg.Wait()
+	v, _ := mpt.Get("hello")
+	check_eq("TestConcurrentReadWrite", v, "world", t)
+}
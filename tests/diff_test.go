@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"../p1"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestDiffVersions(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for i := 0; i < 100; i++ {
+		mpt.Insert("account"+strconv.Itoa(i), "balance"+strconv.Itoa(i))
+	}
+	mpt.Insert("a", "value of a")
+	old_root, _ := mpt.Commit()
+
+	mpt.Insert("account7", "balance changed")
+	mpt.Insert("account100", "new account")
+	mpt.Insert("b", "new key")
+	mpt.Delete("account42")
+	mpt.Delete("a")
+	new_root, _ := mpt.Commit()
+
+	changes, err := mpt.Diff(old_root, new_root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []p1.TrieChange{
+		{Key: "a", OldValue: "value of a", Type: p1.ChangeRemoved},
+		{Key: "account100", NewValue: "new account", Type: p1.ChangeAdded},
+		{Key: "account42", OldValue: "balance42", Type: p1.ChangeRemoved},
+		{Key: "account7", OldValue: "balance7", NewValue: "balance changed", Type: p1.ChangeModified},
+		{Key: "b", NewValue: "new key", Type: p1.ChangeAdded},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		fmt.Println("TestDiffVersions:", changes)
+		t.Fail()
+	}
+
+	same, _ := mpt.Diff(new_root, new_root)
+	if len(same) != 0 {
+		fmt.Println("TestDiffVersions: changes between the same root", same)
+		t.Fail()
+	}
+	if _, err := mpt.Diff(old_root, "HashStart_missing_HashEnd"); err == nil {
+		fmt.Println("TestDiffVersions: missing root accepted")
+		t.Fail()
+	}
+}
+
+func TestDiffApply(t *testing.T) {
+	old_mpt := p1.MerklePatriciaTrie{}
+	old_mpt.Initial()
+	old_mpt.Insert("p", "apple")
+	old_mpt.Insert("aa", "banana")
+	old_mpt.Insert("ap", "orange")
+
+	//different store, and nodes split differently (ext "a" vs leaf "aa")
+	new_mpt := p1.MerklePatriciaTrie{}
+	new_mpt.Initial()
+	new_mpt.Insert("aa", "banana")
+	new_mpt.Insert("a", "value of a")
+	new_mpt.Insert("p", "pear")
+
+	changes, err := p1.DiffMpt(&old_mpt, &new_mpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		fmt.Println("TestDiffApply: wrong changes", changes)
+		t.Fail()
+	}
+	if err := old_mpt.ApplyChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestDiffApply root", old_mpt.GetRoot(), new_mpt.GetRoot(), t)
+
+	back, _ := p1.DiffMpt(&old_mpt, &new_mpt)
+	if len(back) != 0 {
+		fmt.Println("TestDiffApply: changes left after apply", back)
+		t.Fail()
+	}
+}
+
+func TestDiffApplyMissingNode(t *testing.T) {
+	store := p1.NewMemoryNodeStore()
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	root := mpt.GetRoot()
+	for _, hash := range store.Hashes() {
+		if hash != root {
+			store.Delete(hash)
+		}
+	}
+	var missing *p1.MissingNodeError
+	removed := []p1.TrieChange{{Key: "hello", Type: p1.ChangeRemoved, OldValue: "world"}}
+	if err := mpt.ApplyChanges(removed); !errors.As(err, &missing) {
+		fmt.Println("TestDiffApplyMissingNode removed:", err)
+		t.Fail()
+	}
+	//the first change can be applied, the second can't: nothing is applied
+	changes := []p1.TrieChange{
+		{Key: "h", Type: p1.ChangeAdded, NewValue: "new"},
+		{Key: "help", Type: p1.ChangeRemoved, OldValue: "me"},
+	}
+	if err := mpt.ApplyChanges(changes); !errors.As(err, &missing) {
+		fmt.Println("TestDiffApplyMissingNode changes:", err)
+		t.Fail()
+	}
+	check_eq("TestDiffApplyMissingNode root", mpt.GetRoot(), root, t)
+	//a removed key that is not in the trie is still ignored
+	if err := mpt.ApplyChanges([]p1.TrieChange{{Key: "x", Type: p1.ChangeRemoved}}); err != nil {
+		fmt.Println("TestDiffApplyMissingNode absent key:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+/**
+Simulate a chain of blocks mined at hashrate hashes per second, with a difficulty of Retarget:
+the time of a block is exponential with mean difficulty / hashrate.
+Return the times between the blocks.
+ */
+func simulate_chain(t *testing.T, bc *p2.BlockChain, blocks int, hashrate float64, seed int64) []int64 {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	rng := rand.New(rand.NewSource(seed))
+	parentHash := "genesis"
+	timeStamp := int64(1551025401)
+	var times []int64
+	for height := int32(1); height <= int32(blocks); height++ {
+		block := p2.NewBlock(height, timeStamp, parentHash, mpt)
+		difficulty, err := bc.ExpectedDifficulty(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := block.SetDifficulty(difficulty); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+		spent := int64(rng.ExpFloat64() * float64(difficulty) / hashrate)
+		times = append(times, spent)
+		timeStamp += spent
+		parentHash = block.Header.Hash
+	}
+	return times
+}
+
+func average_time(times []int64) float64 {
+	sum := int64(0)
+	for _, time := range times {
+		sum += time
+	}
+	return float64(sum) / float64(len(times))
+}
+
+/**
+The first blocks are far from spacing, the average of the last 400 blocks is within 20% of spacing.
+ */
+func check_convergence(id string, times []int64, spacing float64, early_factor float64, t *testing.T) {
+	early := average_time(times[:10])
+	late := average_time(times[len(times)-400:])
+	if early/spacing < early_factor/4 || early/spacing > early_factor*4 || late < 0.8*spacing || late > 1.2*spacing {
+		fmt.Println(id, "early:", early, "late:", late)
+		t.Fail()
+	}
+}
+
+func TestDifficultyBitcoinConverges(t *testing.T) {
+	//the first difficulty is 8 times too high
+	hashrate := 1000.0
+	bc := p2.NewBlockChain()
+	retarget, err := p2.NewBitcoinRetarget(uint64(hashrate*600*8), 20, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Retarget = retarget
+	times := simulate_chain(t, &bc, 1000, hashrate, 1)
+	check_convergence("TestDifficultyBitcoinConverges", times, 600, 8, t)
+	//the difficulty only changes every 20 blocks
+	for height := int32(2); height <= bc.Length; height++ {
+		block, parent := bc.Get(height)[0], bc.Get(height-1)[0]
+		if (height-1)%20 != 0 && block.Header.Difficulty != parent.Header.Difficulty {
+			fmt.Println("TestDifficultyBitcoinConverges: retarget at height", height)
+			t.Fail()
+		}
+	}
+}
+
+func TestDifficultyEmaConverges(t *testing.T) {
+	//the first difficulty is 8 times too low
+	hashrate := 1000.0
+	bc := p2.NewBlockChain()
+	retarget, err := p2.NewEmaRetarget(uint64(hashrate*600/8), 20, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Retarget = retarget
+	times := simulate_chain(t, &bc, 1000, hashrate, 2)
+	check_convergence("TestDifficultyEmaConverges", times, 600, 1.0/8, t)
+}
+
+func TestDifficultyInsertRejects(t *testing.T) {
+	bc := p2.NewBlockChain()
+	retarget, err := p2.NewEmaRetarget(1000, 20, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Retarget = retarget
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	genesis := p2.NewBlock(1, 1551025401, "genesis", mpt)
+	if bc.Insert(genesis) == nil {
+		fmt.Println("TestDifficultyInsertRejects: block without difficulty inserted")
+		t.Fail()
+	}
+	//the hash doesn't cover a difficulty set without SetDifficulty
+	genesis.Header.Difficulty = 1000
+	if bc.Insert(genesis) == nil {
+		fmt.Println("TestDifficultyInsertRejects: block with a wrong hash inserted")
+		t.Fail()
+	}
+	genesis.SetDifficulty(1000)
+	if err := bc.Insert(genesis); err != nil {
+		t.Fatal(err)
+	}
+	orphan := p2.NewBlock(3, 1551025401, "unknown", mpt)
+	orphan.SetDifficulty(1000)
+	if bc.Insert(orphan) == nil {
+		fmt.Println("TestDifficultyInsertRejects: block without parent inserted")
+		t.Fail()
+	}
+	//a block after 10 seconds is too fast, the difficulty goes up
+	child := p2.NewBlock(2, 1551025411, genesis.Header.Hash, mpt)
+	child.SetDifficulty(1000)
+	if err := bc.Insert(child); err != nil {
+		t.Fatal(err)
+	}
+	grandchild := p2.NewBlock(3, 1551025421, child.Header.Hash, mpt)
+	difficulty, _ := bc.ExpectedDifficulty(grandchild)
+	check_eq("TestDifficultyInsertRejects", fmt.Sprint(difficulty), "1049", t)
+	check_eq("TestDifficultyInsertRejects length", fmt.Sprint(bc.Length), "2", t)
+}
+
+func TestDifficultyMinedChain(t *testing.T) {
+	//with RequirePoW the difficulty is authenticated by the work
+	bc := p2.NewBlockChain()
+	bc.RequirePoW = true
+	retarget, err := p2.NewEmaRetarget(64, 6, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Retarget = retarget
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	miner := p2.NewMiner(2)
+	parentHash := "genesis"
+	for height := int32(1); height <= 5; height++ {
+		block := p2.NewBlock(height, 1551025401+int64(height)*60, parentHash, mpt)
+		difficulty, err := bc.ExpectedDifficulty(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.SetDifficulty(difficulty)
+		if err := miner.Mine(context.Background(), &block); err != nil {
+			t.Fatal(err)
+		}
+		//a lower difficulty is rejected, even with a valid hash
+		cheap := block
+		cheap.SetDifficulty(1)
+		if bc.Insert(cheap) == nil {
+			fmt.Println("TestDifficultyMinedChain: wrong difficulty inserted at height", height)
+			t.Fail()
+		}
+		if err := bc.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+		parentHash = block.Header.Hash
+	}
+	check_eq("TestDifficultyMinedChain", fmt.Sprint(bc.Length), "5", t)
+}
+
+func TestDifficultyInvalidParameters(t *testing.T) {
+	for _, params := range [][3]int64{{0, 20, 600}, {1000, 1, 600}, {1000, 0, 600}, {1000, -5, 600}, {1000, 20, 0}, {1000, 20, -600}} {
+		if retarget, err := p2.NewBitcoinRetarget(uint64(params[0]), int32(params[1]), params[2]); err == nil || retarget != nil {
+			fmt.Println("TestDifficultyInvalidParameters: Bitcoin retarget accepted", params)
+			t.Fail()
+		}
+	}
+	for _, params := range [][3]int64{{0, 20, 600}, {1000, 5, 600}, {1000, 0, 600}, {1000, 20, 0}, {1000, 20, -600}} {
+		if retarget, err := p2.NewEmaRetarget(uint64(params[0]), params[1], params[2]); err == nil || retarget != nil {
+			fmt.Println("TestDifficultyInvalidParameters: EMA retarget accepted", params)
+			t.Fail()
+		}
+	}
+	//a retarget created without its constructor is checked by Insert
+	bc := p2.NewBlockChain()
+	bc.Retarget = &p2.EmaRetarget{Initial: 1000, Window: 20}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	block := p2.NewBlock(1, 1551025401, "genesis", mpt)
+	block.SetDifficulty(1000)
+	if err := bc.Insert(block); err == nil || !strings.Contains(err.Error(), "invalid_retarget") {
+		fmt.Println("TestDifficultyInvalidParameters Insert:", err)
+		t.Fail()
+	}
+}
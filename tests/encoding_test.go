@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"../p1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/sha3"
+	"strings"
+	"testing"
+)
+
+/**
+Test vectors from the Ethereum trie tests (trieanyorder.json).
+ */
+var eth_vectors = []struct {
+	pairs [][2]string
+	root  string
+}{
+	{[][2]string{}, "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"},
+	{[][2]string{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}},
+		"8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+	{[][2]string{{"do", "verb"}, {"horse", "stallion"}, {"doge", "coin"}, {"dog", "puppy"}},
+		"5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"},
+	{[][2]string{{"foo", "bar"}, {"food", "bass"}},
+		"17beaa1648bafa633cda809c90c04af50fc8aed3cb40d16efbddee6fdf63c4c3"},
+	{[][2]string{{"be", "e"}, {"dog", "puppy"}, {"bed", "d"}},
+		"3f67c7a47520f79faa29255d2d3c084a7a6df0453116ed7232ff10277a8be68b"},
+	{[][2]string{{"test", "test"}, {"te", "testy"}},
+		"8452568af70d8d140f58d941338542f645fcca50094b20f3c3d8c3df49337928"},
+}
+
+func TestEthereumRootHash(t *testing.T) {
+	for i, vector := range eth_vectors {
+		//any insertion order gives the same root
+		for _, reverse := range []bool{false, true} {
+			mpt := p1.MerklePatriciaTrie{}
+			mpt.Initial()
+			for j := range vector.pairs {
+				pair := vector.pairs[j]
+				if reverse {
+					pair = vector.pairs[len(vector.pairs)-1-j]
+				}
+				mpt.Insert(pair[0], pair[1])
+			}
+			check_eq(fmt.Sprintf("TestEthereumRootHash %d", i), mpt.RootHash(p1.HashModeEthereum), vector.root, t)
+		}
+	}
+}
+
+func TestCanonicalHashCommitsToPath(t *testing.T) {
+	mpt1 := p1.MerklePatriciaTrie{}
+	mpt1.Initial()
+	mpt1.Insert("a", "same value")
+	mpt2 := p1.MerklePatriciaTrie{}
+	mpt2.Initial()
+	mpt2.Insert("b", "same value")
+	if mpt1.GetRoot() == mpt2.GetRoot() {
+		fmt.Println("TestCanonicalHashCommitsToPath: different keys have the same root")
+		t.Fail()
+	}
+
+	//two leaves with the same value under different paths
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("ab", "same value")
+	mpt.Insert("cb", "same value")
+	mpt.Insert("xyz", "other")
+	mpt.Delete("ab")
+	v, err := mpt.Get("cb")
+	if err != nil {
+		fmt.Println("TestCanonicalHashCommitsToPath:", err)
+		t.Fail()
+	}
+	check_eq("TestCanonicalHashCommitsToPath get", v, "same value", t)
+
+	//the canonical root hash is the hash of the root node
+	check_eq("TestCanonicalHashCommitsToPath root", "HashStart_"+mpt.RootHash(p1.HashModeCanonical)+"_HashEnd", mpt.GetRoot(), t)
+}
+
+func TestCanonicalBranchValueEncoding(t *testing.T) {
+	//"" ends at the root branch with the value "x", "a" = [6,1] is a leaf [1] below child 6
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("", "x")
+	mpt.Insert("a", "1")
+
+	leaf := "c23131" //[compact [1,16], "1"]
+	leaf_raw, _ := hex.DecodeString(leaf)
+	leaf_hash := sha3.Sum256(leaf_raw)
+	//16 children, child 6 is the hash of the leaf, then the stored value "v" + "x"
+	branch := "f3" + strings.Repeat("80", 6) + "a0" + hex.EncodeToString(leaf_hash[:]) + strings.Repeat("80", 9) + "827678"
+	branch_raw, _ := hex.DecodeString(branch)
+	branch_hash := sha3.Sum256(branch_raw)
+	check_eq("TestCanonicalBranchValueEncoding root", mpt.GetRoot(), "HashStart_"+hex.EncodeToString(branch_hash[:])+"_HashEnd", t)
+
+	data := hex.EncodeToString(mpt.MptToByteArray())
+	if !strings.Contains(data, branch) || !strings.Contains(data, leaf) {
+		fmt.Println("TestCanonicalBranchValueEncoding:", data)
+		t.Fail()
+	}
+
+	//the empty value is "v", no value is empty
+	mpt.Insert("", "")
+	empty := "f1" + strings.Replace(branch, "827678", "76", 1)[2:]
+	if !strings.Contains(hex.EncodeToString(mpt.MptToByteArray()), empty) {
+		fmt.Println("TestCanonicalBranchValueEncoding: wrong encoding of the empty value")
+		t.Fail()
+	}
+
+	//a stored value without the marker is corrupt, even with the right hashes
+	bad_branch := strings.Replace(branch, "827678", "827878", 1)
+	bad_raw, _ := hex.DecodeString(bad_branch)
+	bad_hash := sha3.Sum256(bad_raw)
+	bad_data, _ := hex.DecodeString("f85a" + "a0" + hex.EncodeToString(bad_hash[:]) + "b4" + bad_branch + "83" + leaf)
+	var corrupt *p1.CorruptNodeError
+	if _, err := p1.MptFromByteArray(bad_data); !errors.As(err, &corrupt) || !strings.Contains(err.Error(), "branch value") {
+		fmt.Println("TestCanonicalBranchValueEncoding: branch value without marker:", err)
+		t.Fail()
+	}
+}
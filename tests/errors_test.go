@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorPathNotFound(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	if _, err := mpt.Get("a"); !errors.Is(err, p1.ErrPathNotFound) {
+		fmt.Println("TestErrorPathNotFound empty trie:", err)
+		t.Fail()
+	}
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	for _, key := range []string{"", "h", "hel", "hello!", "world"} {
+		if _, err := mpt.Get(key); !errors.Is(err, p1.ErrPathNotFound) {
+			fmt.Println("TestErrorPathNotFound Get", key, err)
+			t.Fail()
+		}
+		if _, err := mpt.Delete(key); !errors.Is(err, p1.ErrPathNotFound) {
+			fmt.Println("TestErrorPathNotFound Delete", key, err)
+			t.Fail()
+		}
+	}
+	check_eq("TestErrorPathNotFound", p1.ErrPathNotFound.Error(), "path_not_found", t)
+}
+
+func TestErrorMissingNode(t *testing.T) {
+	store := p1.NewMemoryNodeStore()
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	root := mpt.GetRoot()
+	for _, hash := range store.Hashes() {
+		if hash != root {
+			store.Delete(hash)
+		}
+	}
+	root_before := mpt.GetRoot()
+	for _, key := range []string{"hello", "help"} {
+		var missing *p1.MissingNodeError
+		if _, err := mpt.Get(key); !errors.As(err, &missing) || missing.Hash == "" || missing.Hash == root {
+			fmt.Println("TestErrorMissingNode Get", key, err)
+			t.Fail()
+		}
+		if _, err := mpt.Delete(key); !errors.As(err, &missing) {
+			fmt.Println("TestErrorMissingNode Delete", key, err)
+			t.Fail()
+		}
+	}
+	//a failed delete doesn't change the trie
+	check_eq("TestErrorMissingNode root", mpt.GetRoot(), root_before, t)
+
+	//an insert doesn't take the missing subtree for an empty one
+	for _, key := range []string{"hello", "helium"} {
+		var missing *p1.MissingNodeError
+		if err := mpt.Insert(key, "new"); !errors.As(err, &missing) {
+			fmt.Println("TestErrorMissingNode Insert", key, err)
+			t.Fail()
+		}
+		if err := mpt.InsertBytes([]byte(key), []byte("new")); !errors.As(err, &missing) {
+			fmt.Println("TestErrorMissingNode InsertBytes", key, err)
+			t.Fail()
+		}
+	}
+	check_eq("TestErrorMissingNode root after insert", mpt.GetRoot(), root_before, t)
+	//"h" splits the root extension, the missing nodes below are kept by their hash
+	if err := mpt.Insert("h", "new"); err != nil {
+		fmt.Println("TestErrorMissingNode Insert h", err)
+		t.Fail()
+	}
+
+	var missing *p1.MissingNodeError
+	if err := mpt.Verify().Err(); !errors.As(err, &missing) {
+		fmt.Println("TestErrorMissingNode Verify:", err)
+		t.Fail()
+	}
+	if _, err := p1.OpenMpt(p1.NewMemoryNodeStore(), root); !errors.As(err, &missing) || missing.Hash != root {
+		fmt.Println("TestErrorMissingNode OpenMpt:", err)
+		t.Fail()
+	}
+	if _, err := mpt.Diff("", root+"x"); !errors.As(err, &missing) {
+		fmt.Println("TestErrorMissingNode Diff:", err)
+		t.Fail()
+	}
+}
+
+func TestErrorCorruptNode(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+
+	var corrupt *p1.CorruptNodeError
+	data := mpt.MptToByteArray()
+	if _, err := p1.MptFromByteArray(data[:len(data)-3]); !errors.As(err, &corrupt) {
+		fmt.Println("TestErrorCorruptNode bytes:", err)
+		t.Fail()
+	}
+
+	json, err := mpt.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(json, "world", "w0rld", -1)
+	if _, err := p1.DecodeMptFromJson(tampered); !errors.As(err, &corrupt) || corrupt.Hash == "" {
+		fmt.Println("TestErrorCorruptNode json:", err)
+		t.Fail()
+	}
+	if errors.Is(err, p1.ErrPathNotFound) {
+		t.Fail()
+	}
+}
+
+func TestErrorInvalidKey(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	pairs := []p1.KeyValuePair{{Key: "b", Value: "1"}, {Key: "a", Value: "2"}}
+	var invalid *p1.InvalidKeyError
+	if err := mpt.BuildFromSorted(pairs); !errors.As(err, &invalid) {
+		fmt.Println("TestErrorInvalidKey:", err)
+		t.Fail()
+	} else {
+		check_eq("TestErrorInvalidKey", invalid.Key, "a", t)
+	}
+}
+
+func TestErrorBlockDecode(t *testing.T) {
+	if _, err := p2.DecodeFromJson("{\"height\":1,\"mpt\":"); err == nil {
+		fmt.Println("TestErrorBlockDecode: no error for a truncated block")
+		t.Fail()
+	}
+	block, err := p2.DecodeFromJson("{\"height\":1,\"timeStamp\":1,\"hash\":\"h\",\"parentHash\":\"genesis\",\"size\":1,\"mpt\":{\"a\":\"1\"}}")
+	if err != nil {
+		fmt.Println("TestErrorBlockDecode:", err)
+		t.Fail()
+	}
+	if _, err := block.Value.Get("b"); !errors.Is(err, p1.ErrPathNotFound) {
+		fmt.Println("TestErrorBlockDecode Get:", err)
+		t.Fail()
+	}
+}
+
+func TestErrorBlockFromByteArray(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	block := p2.NewBlock(1, 1234567890, "genesis", mpt)
+	data := mpt.MptToByteArray()
+
+	decoded, err := p2.BlockFromByteArray(block.Header, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestErrorBlockFromByteArray root", decoded.Value.GetRoot(), mpt.GetRoot(), t)
+	if err := decoded.VerifyHash(); err != nil {
+		t.Error(err)
+	}
+
+	var corrupt *p1.CorruptNodeError
+	if _, err := p2.BlockFromByteArray(block.Header, data[:len(data)-3]); !errors.As(err, &corrupt) {
+		fmt.Println("TestErrorBlockFromByteArray truncated:", err)
+		t.Fail()
+	}
+	//the tampered node doesn't match the hash in its parent
+	var missing *p1.MissingNodeError
+	tampered := []byte(strings.Replace(string(data), "world", "w0rld", 1))
+	if _, err := p2.BlockFromByteArray(block.Header, tampered); !errors.As(err, &corrupt) && !errors.As(err, &missing) {
+		fmt.Println("TestErrorBlockFromByteArray tampered:", err)
+		t.Fail()
+	}
+}
+
+func TestErrorOpenBlock(t *testing.T) {
+	store := p1.NewMemoryNodeStore()
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	mpt.Insert("bonjour", "monde")
+	//only the nodes of the last root are left
+	mpt.CollectGarbage()
+	block := p2.NewBlock(1, 1234567890, "genesis", mpt)
+	root := mpt.GetRoot()
+
+	opened, err := p2.OpenBlock(block.Header, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := opened.Value.Get("help")
+	check_eq("TestErrorOpenBlock", v, "me", t)
+
+	var missing *p1.MissingNodeError
+	if _, err := p2.OpenBlock(block.Header, p1.NewMemoryNodeStore(), root); !errors.As(err, &missing) || missing.Hash != root {
+		fmt.Println("TestErrorOpenBlock empty store:", err)
+		t.Fail()
+	}
+
+	//a node below the root is replaced by another node
+	var below []string
+	for _, hash := range store.Hashes() {
+		if hash != root {
+			below = append(below, hash)
+		}
+	}
+	other, _ := store.Get(below[0])
+	store.Put(below[1], other)
+	var corrupt *p1.CorruptNodeError
+	if _, err := p2.OpenBlock(block.Header, store, root); !errors.As(err, &corrupt) {
+		fmt.Println("TestErrorOpenBlock corrupt:", err)
+		t.Fail()
+	}
+
+	//a node below the root is deleted
+	store.Delete(below[1])
+	if _, err := p2.OpenBlock(block.Header, store, root); !errors.As(err, &missing) || missing.Hash != below[1] {
+		fmt.Println("TestErrorOpenBlock missing:", err)
+		t.Fail()
+	}
+	if errors.Is(err, p1.ErrPathNotFound) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func export_mpt() p1.MerklePatriciaTrie {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("a", "value \"of\" a")
+	mpt.Insert("b", "new")
+	mpt.Delete("b")
+	return mpt
+}
+
+func TestMptJsonRoundTrip(t *testing.T) {
+	mpt := export_mpt()
+	jsonString, err := mpt.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := p1.DecodeMptFromJson(jsonString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestMptJsonRoundTrip root", decoded.GetRoot(), mpt.GetRoot(), t)
+	again, _ := decoded.EncodeToJson()
+	check_eq("TestMptJsonRoundTrip nodes", again, jsonString, t)
+	v, _ := decoded.Get("a")
+	check_eq("TestMptJsonRoundTrip get", v, "value \"of\" a", t)
+	//the deleted leaf is not exported
+	if report := decoded.CollectGarbage(); report.NodesReclaimed != 0 {
+		fmt.Println("TestMptJsonRoundTrip: unreachable nodes exported")
+		t.Fail()
+	}
+
+	tampered := strings.Replace(jsonString, "apple", "APPLE", 1)
+	if _, err := p1.DecodeMptFromJson(tampered); err == nil {
+		fmt.Println("TestMptJsonRoundTrip: tampered node accepted")
+		t.Fail()
+	}
+	missing := strings.Replace(jsonString, `"root":"`, `"root":"HashStart_00`, 1)
+	if _, err := p1.DecodeMptFromJson(missing); err == nil {
+		fmt.Println("TestMptJsonRoundTrip: missing root accepted")
+		t.Fail()
+	}
+}
+
+func TestMptToDot(t *testing.T) {
+	mpt := export_mpt()
+	dot := mpt.ToDot()
+	if !strings.HasPrefix(dot, "digraph mpt {") || !strings.HasSuffix(dot, "}\n") {
+		fmt.Println("TestMptToDot: not a graph\n", dot)
+		t.Fail()
+	}
+	for _, expected := range []string{"Ext path=1", "Branch", "Leaf path=1\\nvalue=\\\"banana\\\"", "[label=\"7\"]"} {
+		if !strings.Contains(dot, expected) {
+			fmt.Println("TestMptToDot: missing", expected, "\n", dot)
+			t.Fail()
+		}
+	}
+	check_eq("TestMptToDot edges", fmt.Sprint(strings.Count(dot, "->")), "5", t)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	expected := map[string]string{}
+	for i := 0; i < 50; i++ {
+		key := "key" + strconv.Itoa(i%20)
+		value := "value" + strconv.Itoa(i)
+		mpt.Insert(key, value)
+		expected[key] = value
+	}
+	report := mpt.CollectGarbage()
+	if report.NodesReclaimed == 0 || report.BytesReclaimed == 0 {
+		fmt.Println("no orphaned nodes reclaimed:", report)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(mpt.GetMptMap(mpt.GetRoot(), []uint8{}), expected) {
+		fmt.Println("TestCollectGarbage: trie changed by the collection")
+		t.Fail()
+	}
+	again := mpt.CollectGarbage()
+	if again.NodesReclaimed != 0 || again.NodesLive != report.NodesLive {
+		fmt.Println("second run reclaimed nodes:", again)
+		t.Fail()
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	var roots []string
+	for i := 0; i < 5; i++ {
+		mpt.Insert("user:alice", "alice balance"+strconv.Itoa(i))
+		mpt.Insert("user:bob"+strconv.Itoa(i), "bob balance"+strconv.Itoa(i))
+		root, _ := mpt.Commit()
+		roots = append(roots, root)
+	}
+	//the current root is live even if it is not committed
+	mpt.Insert("user:carol", "pending")
+
+	report := mpt.Prune(2)
+	if report.NodesReclaimed == 0 {
+		fmt.Println("TestPruneVersions: nothing reclaimed")
+		t.Fail()
+	}
+	if !reflect.DeepEqual(mpt.GetVersions(), roots[3:]) {
+		fmt.Println("TestPruneVersions: wrong versions", mpt.GetVersions())
+		t.Fail()
+	}
+	if _, err := mpt.ViewAt(roots[0]); err == nil {
+		fmt.Println("TestPruneVersions: pruned version can still be opened")
+		t.Fail()
+	}
+	view, err := mpt.ViewAt(roots[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := view.Get("user:alice")
+	check_eq("TestPruneVersions version 3", v, "alice balance3", t)
+	v, _ = view.Get("user:bob0")
+	check_eq("TestPruneVersions version 3 bob0", v, "bob balance0", t)
+	v, _ = mpt.Get("user:carol")
+	check_eq("TestPruneVersions current", v, "pending", t)
+}
+
+/**
+failing_store is a store whose Flush always fails, like a full disk.
+ */
+type failing_store struct {
+	*p1.MemoryNodeStore
+}
+
+func (store failing_store) Flush() error {
+	return errors.New("disk full")
+}
+
+func TestCollectGarbageFlushError(t *testing.T) {
+	var _ p1.Flusher = failing_store{}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(failing_store{p1.NewMemoryNodeStore()})
+	mpt.Insert("a", "apple")
+	mpt.Insert("a", "avocado")
+	report := mpt.CollectGarbage()
+	if report.Err == nil || report.Err.Error() != "disk full" {
+		fmt.Println("TestCollectGarbageFlushError:", report)
+		t.Fail()
+	}
+	if report := mpt.Prune(0); report.Err == nil {
+		fmt.Println("TestCollectGarbageFlushError Prune:", report)
+		t.Fail()
+	}
+
+	memory := p1.MerklePatriciaTrie{}
+	memory.Initial()
+	memory.Insert("a", "apple")
+	if report := memory.CollectGarbage(); report.Err != nil {
+		fmt.Println("TestCollectGarbageFlushError memory:", report.Err)
+		t.Fail()
+	}
+}
+
+func TestCollectGarbageCopies(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("a", "apple")
+	mpt.Insert("b", "banana")
+
+	//a copy by assignment shares the fork: its root must be passed in extra_roots
+	copied := mpt
+	mpt.Insert("c", "cherry")
+	//a block value is a clone, its root is live
+	block := p2.NewBlock(1, 1551025401, "genesis", mpt)
+
+	mpt.Insert("a", "apricot")
+	mpt.CollectGarbage(copied.GetRoot())
+
+	v, err := copied.Get("a")
+	if err != nil {
+		fmt.Println("TestCollectGarbageCopies copy:", err)
+		t.Fail()
+	}
+	check_eq("TestCollectGarbageCopies copy", v, "apple", t)
+	v, err = block.Value.Get("c")
+	if err != nil {
+		fmt.Println("TestCollectGarbageCopies block:", err)
+		t.Fail()
+	}
+	check_eq("TestCollectGarbageCopies block", v, "cherry", t)
+	v, _ = mpt.Get("a")
+	check_eq("TestCollectGarbageCopies current", v, "apricot", t)
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func header_block(t *testing.T, jsonString string) p2.Block {
+	block, err := p2.DecodeFromJson(jsonString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func header_preimage(t *testing.T, block p2.Block) string {
+	preimage, err := block.EncodeHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(preimage)
+}
+
+func TestHeaderLegacyPreimage(t *testing.T) {
+	//one rune per integer, U+FFFD for the values that are not code points
+	block := header_block(t, "{\"height\":65,\"timeStamp\":1551025401,\"hash\":\"h\",\"parentHash\":\"p\",\"size\":66,\"mpt\":{}}")
+	check_eq("TestHeaderLegacyPreimage", header_preimage(t, block), "A�pB", t)
+	//not truncated to 32 bits: 2^32 + 65 is not "A"
+	block = header_block(t, "{\"height\":65,\"timeStamp\":4294967361,\"hash\":\"h\",\"parentHash\":\"p\",\"size\":66,\"mpt\":{}}")
+	check_eq("TestHeaderLegacyPreimage 2^32+65", header_preimage(t, block), "A�pB", t)
+	block = header_block(t, "{\"height\":65,\"timeStamp\":-1,\"hash\":\"h\",\"parentHash\":\"p\",\"size\":66,\"mpt\":{}}")
+	check_eq("TestHeaderLegacyPreimage -1", header_preimage(t, block), "A�pB", t)
+	block = header_block(t, "{\"height\":65,\"timeStamp\":233,\"hash\":\"h\",\"parentHash\":\"p\",\"size\":66,\"mpt\":{}}")
+	check_eq("TestHeaderLegacyPreimage 233", header_preimage(t, block), "AépB", t)
+}
+
+func TestHeaderCanonicalEncoding(t *testing.T) {
+	block := header_block(t, "{\"height\":1,\"timeStamp\":1551025401,\"hash\":\"h\",\"parentHash\":\"genesis\",\"size\":3,"+
+		"\"nonce\":5,\"difficulty\":7,\"version\":1,\"mpt\":{}}")
+	expected := "00000001" + "00000001" + "000000005c72c4f9" + "00000007" + hex.EncodeToString([]byte("genesis")) +
+		"00000000" + "00000003" + "0000000000000005" + "0000000000000007"
+	check_eq("TestHeaderCanonicalEncoding", hex.EncodeToString([]byte(header_preimage(t, block))), expected, t)
+
+	//two timestamps with the same legacy preimage have different canonical preimages
+	legacy1 := header_block(t, "{\"height\":1,\"timeStamp\":1551025401,\"hash\":\"h\",\"parentHash\":\"genesis\",\"size\":3,\"mpt\":{}}")
+	legacy2 := header_block(t, "{\"height\":1,\"timeStamp\":1551025402,\"hash\":\"h\",\"parentHash\":\"genesis\",\"size\":3,\"mpt\":{}}")
+	if header_preimage(t, legacy1) != header_preimage(t, legacy2) {
+		fmt.Println("TestHeaderCanonicalEncoding: legacy preimages differ")
+		t.Fail()
+	}
+	legacy1.Header.Version = p2.CanonicalHeaderVersion
+	legacy2.Header.Version = p2.CanonicalHeaderVersion
+	if header_preimage(t, legacy1) == header_preimage(t, legacy2) {
+		fmt.Println("TestHeaderCanonicalEncoding: canonical preimages collide")
+		t.Fail()
+	}
+}
+
+/**
+Blocks encoded by the first version of the code (legacy preimage), the second block is the child of the first.
+ */
+var legacy_fixture = []string{
+	"{\"height\":1,\"timeStamp\":1551025401,\"hash\":\"34376e1c83dccedc43375f8c98f466c68911bc3897549b3db08e2dc27aa62e9a\"," +
+		"\"parentHash\":\"genesis\",\"size\":227,\"mpt\":{\"hello\":\"world\"}}",
+	"{\"height\":2,\"timeStamp\":1551025502,\"hash\":\"6f6bcc2136b65845f528d8ea0d2f98ff664c668760643df232177133694a884c\"," +
+		"\"parentHash\":\"34376e1c83dccedc43375f8c98f466c68911bc3897549b3db08e2dc27aa62e9a\",\"size\":911," +
+		"\"mpt\":{\"charles\":\"ge\",\"hello\":\"world\"}}",
+}
+
+func TestHeaderLegacyFixture(t *testing.T) {
+	for _, fixture := range legacy_fixture {
+		block := header_block(t, fixture)
+		check_eq("TestHeaderLegacyFixture version", fmt.Sprint(block.Header.Version), fmt.Sprint(p2.LegacyHeaderVersion), t)
+		if err := block.VerifyHash(); err != nil {
+			fmt.Println("TestHeaderLegacyFixture:", block.Header.Height, err)
+			t.Fail()
+		}
+		//the JSON encoding of an old block doesn't change
+		json, _ := block.EncodeToJson()
+		check_eq("TestHeaderLegacyFixture json", json, fixture, t)
+
+		//the hash of a version doesn't validate another version
+		block.Header.Version = p2.CanonicalHeaderVersion
+		if block.VerifyHash() == nil {
+			fmt.Println("TestHeaderLegacyFixture: legacy hash accepted as canonical")
+			t.Fail()
+		}
+	}
+	bc, err := p2.DecodeJsonToBlockChain("[" + strings.Join(legacy_fixture, ",") + "]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := bc.Get(2)[0]
+	parent, ok := bc.GetParent(child)
+	if !ok || parent.VerifyHash() != nil || child.VerifyHash() != nil {
+		fmt.Println("TestHeaderLegacyFixture: chain of legacy blocks")
+		t.Fail()
+	}
+}
+
+func TestHeaderVersionsSideBySide(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	canonical := p2.NewBlock(1, 1551025401, "genesis", mpt)
+	check_eq("TestHeaderVersionsSideBySide version", fmt.Sprint(canonical.Header.Version), fmt.Sprint(p2.CanonicalHeaderVersion), t)
+	legacy := header_block(t, legacy_fixture[0])
+
+	for _, block := range []p2.Block{canonical, legacy} {
+		if err := block.VerifyHash(); err != nil {
+			fmt.Println("TestHeaderVersionsSideBySide:", block.Header.Version, err)
+			t.Fail()
+		}
+		//the JSON encoding keeps the version
+		json, _ := block.EncodeToJson()
+		decoded := header_block(t, json)
+		if err := decoded.VerifyHash(); err != nil {
+			fmt.Println("TestHeaderVersionsSideBySide decoded:", block.Header.Version, err)
+			t.Fail()
+		}
+	}
+	//the canonical hash covers the root of the value, the legacy hash doesn't
+	other := p1.MerklePatriciaTrie{}
+	other.Initial()
+	other.Insert("hello", "there")
+	canonical.Value = other
+	if canonical.VerifyHash() == nil {
+		fmt.Println("TestHeaderVersionsSideBySide: canonical hash accepted with another value")
+		t.Fail()
+	}
+	canonical.Header.Version = 9
+	if err := canonical.VerifyHash(); err == nil || !strings.Contains(err.Error(), "unknown header version") {
+		fmt.Println("TestHeaderVersionsSideBySide unknown version:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func iterator_keys(it *p1.MptIterator) []string {
+	keys := []string{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func check_keys(id string, real []string, expected []string, t *testing.T) {
+	if !reflect.DeepEqual(real, expected) {
+		fmt.Println("=========" + id + "============")
+		fmt.Println("Real:", real)
+		fmt.Println("Expected:", expected)
+		t.Fail()
+	}
+}
+
+func iterator_mpt() (p1.MerklePatriciaTrie, []string) {
+	keys := []string{"user:bob", "user:alice", "user:", "admin", "user:alice2", "u", "zeta", "a", "ab"}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for _, k := range keys {
+		mpt.Insert(k, "value of "+k)
+	}
+	sort.Strings(keys)
+	return mpt, keys
+}
+
+func TestIteratorOrder(t *testing.T) {
+	mpt, keys := iterator_mpt()
+	it := mpt.NewIterator("", false)
+	real := []string{}
+	for it.Next() {
+		real = append(real, it.Key())
+		check_eq("TestIteratorOrder value", it.Value(), "value of "+it.Key(), t)
+	}
+	check_keys("TestIteratorOrder", real, keys, t)
+
+	reversed := []string{}
+	for i := len(keys) - 1; i >= 0; i-- {
+		reversed = append(reversed, keys[i])
+	}
+	check_keys("TestIteratorOrder reverse", iterator_keys(mpt.NewIterator("", true)), reversed, t)
+}
+
+func TestIteratorPrefix(t *testing.T) {
+	mpt, _ := iterator_mpt()
+	check_keys("TestIteratorPrefix", iterator_keys(mpt.NewIterator("user:", false)),
+		[]string{"user:", "user:alice", "user:alice2", "user:bob"}, t)
+	check_keys("TestIteratorPrefix reverse", iterator_keys(mpt.NewIterator("user:", true)),
+		[]string{"user:bob", "user:alice2", "user:alice", "user:"}, t)
+	check_keys("TestIteratorPrefix none", iterator_keys(mpt.NewIterator("nobody", false)), []string{}, t)
+}
+
+func TestIteratorSeek(t *testing.T) {
+	mpt, _ := iterator_mpt()
+	it := mpt.NewIterator("user:", false)
+	it.Seek("user:alice1")
+	check_keys("TestIteratorSeek", iterator_keys(it), []string{"user:alice2", "user:bob"}, t)
+
+	it = mpt.NewIterator("user:", false)
+	it.Seek("a")
+	check_keys("TestIteratorSeek before prefix", iterator_keys(it),
+		[]string{"user:", "user:alice", "user:alice2", "user:bob"}, t)
+
+	it = mpt.NewIterator("", true)
+	it.Seek("ab")
+	check_keys("TestIteratorSeek reverse", iterator_keys(it), []string{"ab", "a"}, t)
+
+	it = mpt.NewIterator("", true)
+	it.Seek("b")
+	check_keys("TestIteratorSeek reverse 2", iterator_keys(it), []string{"admin", "ab", "a"}, t)
+}
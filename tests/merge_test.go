@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloneCopyOnWrite(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("alice", "100")
+	mpt.Insert("bob", "50")
+	parent := p2.NewBlock(1, 1234567890, "genesis", mpt)
+
+	//two competing blocks forked from the same state
+	fork1 := parent.Value.Clone()
+	fork1.Insert("alice", "90")
+	fork2 := parent.Value.Clone()
+	fork2.Insert("carol", "10")
+	block1 := p2.NewBlock(2, 1234567891, parent.Header.Hash, fork1)
+	block2 := p2.NewBlock(2, 1234567892, parent.Header.Hash, fork2)
+
+	check_eq("TestCloneCopyOnWrite parent root", parent.Value.GetRoot(), mpt.GetRoot(), t)
+	v, _ := parent.Value.Get("alice")
+	check_eq("TestCloneCopyOnWrite parent", v, "100", t)
+	v, _ = block1.Value.Get("alice")
+	check_eq("TestCloneCopyOnWrite fork1", v, "90", t)
+	if _, err := block1.Value.Get("carol"); err == nil {
+		fmt.Println("TestCloneCopyOnWrite: fork2 key in fork1")
+		t.Fail()
+	}
+	v, _ = block2.Value.Get("carol")
+	check_eq("TestCloneCopyOnWrite fork2", v, "10", t)
+
+	chain := p2.NewBlockChain()
+	for _, block := range []p2.Block{parent, block1, block2} {
+		if err := chain.Insert(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check_eq("TestCloneCopyOnWrite forks", fmt.Sprint(len(chain.Get(2))), "2", t)
+}
+
+func TestMerge(t *testing.T) {
+	ours := p1.MerklePatriciaTrie{}
+	ours.Initial()
+	ours.Insert("alice", "100")
+	ours.Insert("bob", "50")
+	ours.Insert("dave", "1")
+
+	theirs := p1.MerklePatriciaTrie{}
+	theirs.Initial()
+	theirs.Insert("alice", "120")
+	theirs.Insert("bob", "50")
+	theirs.Insert("carol", "10")
+
+	var conflicts []string
+	err := ours.Merge(&theirs, func(key string, our_value string, their_value string) string {
+		conflicts = append(conflicts, key)
+		return our_value + "+" + their_value
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"alice": "100+120", "bob": "50", "carol": "10", "dave": "1"}
+	if !reflect.DeepEqual(ours.GetMptMap(ours.GetRoot(), []uint8{}), expected) {
+		fmt.Println("TestMerge:", ours.GetMptMap(ours.GetRoot(), []uint8{}))
+		t.Fail()
+	}
+	if !reflect.DeepEqual(conflicts, []string{"alice"}) {
+		fmt.Println("TestMerge: wrong conflicts", conflicts)
+		t.Fail()
+	}
+	v, _ := theirs.Get("alice")
+	check_eq("TestMerge other unchanged", v, "120", t)
+
+	//a clone merged back, the value of the clone wins by default
+	clone := ours.Clone()
+	clone.Insert("alice", "0")
+	clone.Insert("erin", "5")
+	ours.Merge(&clone, nil)
+	check_eq("TestMerge clone", ours.GetRoot(), clone.GetRoot(), t)
+}
+
+/**
+Run f, fail if it doesn't return in 10 seconds (a deadlock).
+ */
+func within_deadline(id string, t *testing.T, f func()) {
+	done := make(chan bool)
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		fmt.Println(id, "deadlock")
+		t.FailNow()
+	}
+}
+
+func TestMergeResolverReads(t *testing.T) {
+	ours := p1.MerklePatriciaTrie{}
+	ours.Initial()
+	ours.Insert("alice", "100")
+	ours.Insert("bonus", "5")
+	theirs := ours.Clone()
+	theirs.Insert("alice", "120")
+	within_deadline("TestMergeResolverReads", t, func() {
+		err := ours.Merge(&theirs, func(key string, our_value string, their_value string) string {
+			//the resolver reads both tries
+			bonus, _ := ours.Get("bonus")
+			current, _ := theirs.Get(key)
+			return our_value + "+" + current + "+" + bonus
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	v, _ := ours.Get("alice")
+	check_eq("TestMergeResolverReads", v, "100+120+5", t)
+}
+
+func TestMergeConcurrent(t *testing.T) {
+	a := p1.MerklePatriciaTrie{}
+	a.Initial()
+	b := p1.MerklePatriciaTrie{}
+	b.Initial()
+	keep_ours := func(key string, our_value string, their_value string) string { return our_value }
+	within_deadline("TestMergeConcurrent", t, func() {
+		var group sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			group.Add(3)
+			go func() {
+				defer group.Done()
+				for j := 0; j < 100; j++ {
+					a.Merge(&b, keep_ours)
+				}
+			}()
+			go func() {
+				defer group.Done()
+				for j := 0; j < 100; j++ {
+					b.Merge(&a, keep_ours)
+				}
+			}()
+			go func(i int) {
+				defer group.Done()
+				for j := 0; j < 100; j++ {
+					a.Insert("a"+strconv.Itoa(i*100+j), "1")
+					b.Insert("b"+strconv.Itoa(i*100+j), "2")
+				}
+			}(i)
+		}
+		group.Wait()
+	})
+	//a last merge in each direction: both tries have every key
+	a.Merge(&b, keep_ours)
+	b.Merge(&a, keep_ours)
+	check_eq("TestMergeConcurrent", b.GetRoot(), a.GetRoot(), t)
+	check_eq("TestMergeConcurrent keys", fmt.Sprint(len(a.GetMptMap(a.GetRoot(), []uint8{}))), "400", t)
+}
+
+func TestCloneForkGc(t *testing.T) {
+	store := p1.NewMemoryNodeStore()
+	a := p1.MerklePatriciaTrie{}
+	a.InitialWithStore(store)
+	a.Insert("alice", "100")
+	a.Insert("bob", "50")
+	a.Commit()
+	b := a.Clone()
+	b.Insert("carol", "20")
+	b.Commit()
+	a.Insert("bob", "60")
+	a.Commit()
+	a.Insert("alice", "90")
+	a.Commit()
+	check_eq("TestCloneForkGc versions of a", fmt.Sprint(len(a.GetVersions())), "3", t)
+	check_eq("TestCloneForkGc versions of b", fmt.Sprint(len(b.GetVersions())), "2", t)
+
+	//pruning a keeps the root and the versions of b
+	a.Prune(1)
+	v, err := b.Get("bob")
+	check_eq("TestCloneForkGc b bob", v, "50", t)
+	if err != nil {
+		t.Error(err)
+	}
+	for i := range b.GetVersions() {
+		view, err := b.ViewAtVersion(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ = view.Get("alice")
+		check_eq("TestCloneForkGc b version alice", v, "100", t)
+	}
+	check_eq("TestCloneForkGc versions of a", fmt.Sprint(len(a.GetVersions())), "1", t)
+	check_eq("TestCloneForkGc versions of b", fmt.Sprint(len(b.GetVersions())), "2", t)
+
+	//once b is released, its nodes are collected
+	b_root := b.GetRoot()
+	b.Release()
+	a.CollectGarbage()
+	if _, ok := store.Get(b_root); ok {
+		fmt.Println("TestCloneForkGc: the root of a released fork is live")
+		t.Fail()
+	}
+	v, _ = a.Get("alice")
+	check_eq("TestCloneForkGc a alice", v, "90", t)
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func pow_block(parentHash string, difficulty uint64) p2.Block {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	mpt.Insert("charles", "ge")
+	block := p2.NewBlock(1, 1551025401, parentHash, mpt)
+	block.SetDifficulty(difficulty)
+	return block
+}
+
+func TestPoWMine(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		block := pow_block("genesis", 1<<10)
+		if err := p2.NewMiner(workers).Mine(context.Background(), &block); err != nil {
+			fmt.Println("TestPoWMine:", err)
+			t.Fail()
+			continue
+		}
+		if err := block.VerifyPoW(); err != nil {
+			fmt.Println("TestPoWMine VerifyPoW:", workers, err)
+			t.Fail()
+		}
+		tampered := block
+		tampered.Header.Nonce++
+		if tampered.VerifyPoW() == nil {
+			fmt.Println("TestPoWMine: wrong nonce accepted")
+			t.Fail()
+		}
+	}
+	//without a difficulty there is nothing to mine
+	block := pow_block("genesis", 0)
+	if p2.NewMiner(1).Mine(context.Background(), &block) == nil || block.VerifyPoW() == nil {
+		t.Fail()
+	}
+}
+
+func TestPoWCancel(t *testing.T) {
+	block := pow_block("genesis", 1<<62)
+	hash := block.Header.Hash
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := p2.NewMiner(2).Mine(ctx, &block)
+	if err != context.DeadlineExceeded {
+		fmt.Println("TestPoWCancel:", err)
+		t.Fail()
+	}
+	check_eq("TestPoWCancel hash", block.Header.Hash, hash, t)
+}
+
+func TestPoWBlockChain(t *testing.T) {
+	bc := p2.NewBlockChain()
+	bc.RequirePoW = true
+	//SetDifficulty hashes the block with nonce 0: the hash is valid, but not below the target
+	unmined := pow_block("genesis", 1<<8)
+	if bc.Insert(unmined) == nil {
+		fmt.Println("TestPoWBlockChain: block without proof of work inserted")
+		t.Fail()
+	}
+	mined := pow_block("genesis", 1<<8)
+	if err := p2.NewMiner(2).Mine(context.Background(), &mined); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Insert(mined); err != nil {
+		fmt.Println("TestPoWBlockChain:", err)
+		t.Fail()
+	}
+	check_eq("TestPoWBlockChain length", fmt.Sprint(bc.Length), "1", t)
+
+	//the nonce and the difficulty are kept by the JSON encoding
+	json, err := mined.EncodeToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := p2.DecodeFromJson(json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.VerifyPoW(); err != nil {
+		fmt.Println("TestPoWBlockChain decoded:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"testing"
+)
+
+func TestProofMembership(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("a", "root of a")
+	mpt.Insert("aaa", "cherry")
+
+	for _, key := range []string{"p", "aa", "ap", "a", "aaa"} {
+		expected, _ := mpt.Get(key)
+		proof := mpt.GetProof(key)
+		value, exists, err := p1.VerifyProof(mpt.GetRoot(), key, proof)
+		if err != nil || !exists {
+			fmt.Println("VerifyProof failed:", key, err)
+			t.Fail()
+		}
+		check_eq("TestProofMembership "+key, value, expected, t)
+	}
+}
+
+func TestProofNonMembership(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+
+	for _, key := range []string{"b", "a", "aab", "pp", "ab", "q"} {
+		proof := mpt.GetProof(key)
+		value, exists, err := p1.VerifyProof(mpt.GetRoot(), key, proof)
+		if err != nil || exists || value != "" {
+			fmt.Println("non-membership failed:", key, value, exists, err)
+			t.Fail()
+		}
+	}
+
+	empty := p1.MerklePatriciaTrie{}
+	empty.Initial()
+	_, exists, err := p1.VerifyProof(empty.GetRoot(), "a", empty.GetProof("a"))
+	if err != nil || exists {
+		fmt.Println("empty trie proof failed:", err)
+		t.Fail()
+	}
+}
+
+func TestProofInvalid(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	root := mpt.GetRoot()
+	proof := mpt.GetProof("aa")
+
+	//wrong root
+	other := p1.MerklePatriciaTrie{}
+	other.Initial()
+	other.Insert("aa", "banana")
+	if _, _, err := p1.VerifyProof(other.GetRoot(), "aa", proof); err == nil {
+		fmt.Println("proof accepted with a wrong root")
+		t.Fail()
+	}
+	//truncated proof
+	if _, _, err := p1.VerifyProof(root, "aa", proof[:len(proof)-1]); err == nil {
+		fmt.Println("truncated proof accepted")
+		t.Fail()
+	}
+	//proof of another key
+	if _, _, err := p1.VerifyProof(root, "aa", mpt.GetProof("p")); err == nil {
+		fmt.Println("proof of another key accepted")
+		t.Fail()
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestRangeProofChunkedSync(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for i := 0; i < 200; i++ {
+		mpt.Insert("account"+strconv.Itoa(i), "balance"+strconv.Itoa(i))
+	}
+	root := mpt.GetRoot()
+
+	//download the state in verified chunks of 30 pairs
+	synced := p1.MerklePatriciaTrie{}
+	synced.Initial()
+	start, chunks := "", 0
+	for {
+		proof := mpt.GetRangeProof(start, "\xff", 30)
+		if err := p1.VerifyRangeProof(root, proof); err != nil {
+			t.Fatal(err)
+		}
+		synced.InsertBatch(proof.Pairs)
+		chunks++
+		if proof.End == "\xff" {
+			break
+		}
+		start = proof.End + "\x00"
+	}
+	check_eq("TestRangeProofChunkedSync root", synced.GetRoot(), root, t)
+	check_eq("TestRangeProofChunkedSync chunks", strconv.Itoa(chunks), "7", t)
+}
+
+func TestRangeProofInvalid(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for i := 0; i < 50; i++ {
+		mpt.Insert("key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+	proof := mpt.GetRangeProof("key2", "key4", 0)
+	if err := p1.VerifyRangeProof(mpt.GetRoot(), proof); err != nil || len(proof.Pairs) != 23 {
+		fmt.Println("TestRangeProofInvalid: valid proof rejected", err, len(proof.Pairs))
+		t.FailNow()
+	}
+
+	hidden := proof
+	hidden.Pairs = append(append([]p1.KeyValuePair{}, proof.Pairs[:5]...), proof.Pairs[6:]...)
+	changed := proof
+	changed.Pairs = append([]p1.KeyValuePair{}, proof.Pairs...)
+	changed.Pairs[3].Value = "forged"
+	added := proof
+	added.Pairs = append(append([]p1.KeyValuePair{}, proof.Pairs...), p1.KeyValuePair{Key: "key3x", Value: "forged"})
+	missing := proof
+	missing.Nodes = proof.Nodes[1:]
+	for name, forged := range map[string]p1.RangeProof{"hidden": hidden, "changed": changed, "added": added, "missing": missing} {
+		if err := p1.VerifyRangeProof(mpt.GetRoot(), forged); err == nil {
+			fmt.Println("TestRangeProofInvalid: forged proof accepted:", name)
+			t.Fail()
+		}
+	}
+
+	//an empty range is proved too
+	empty := mpt.GetRangeProof("key99", "key990", 0)
+	if err := p1.VerifyRangeProof(mpt.GetRoot(), empty); err != nil || len(empty.Pairs) != 0 {
+		fmt.Println("TestRangeProofInvalid: empty range", err)
+		t.Fail()
+	}
+}
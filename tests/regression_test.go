@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"testing"
+)
+
+/**
+Get key and compare with expected, "" means that the key must not be found. A panic is a failure.
+ */
+func regression_get(t *testing.T, id string, mpt *p1.MerklePatriciaTrie, key string, expected string) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(id, "Get", key, "panic:", r)
+			t.Fail()
+		}
+	}()
+	value, err := mpt.Get(key)
+	if expected == "" {
+		if err == nil {
+			fmt.Println(id, "Get", key, "found", value)
+			t.Fail()
+		}
+		return
+	}
+	check_eq(id+" "+key, value, expected, t)
+}
+
+func TestRegressionGetMismatch(t *testing.T) {
+	//"ac" differs from the leaf path "ab" in its last nibble
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("ab", "value of ab")
+	regression_get(t, "TestRegressionGetMismatch", &mpt, "ab", "value of ab")
+	regression_get(t, "TestRegressionGetMismatch", &mpt, "ac", "")
+}
+
+func TestRegressionGetEndsAtBranch(t *testing.T) {
+	//"a" ends at a branch below a branch, without a value
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("ab", "value of ab")
+	mpt.Insert("aq", "value of aq")
+	mpt.Insert("bb", "value of bb")
+	regression_get(t, "TestRegressionGetEndsAtBranch", &mpt, "a", "")
+	regression_get(t, "TestRegressionGetEndsAtBranch", &mpt, "aq", "value of aq")
+}
+
+func TestRegressionInsertPrefixOfLeaf(t *testing.T) {
+	//the new key is a prefix of the leaf path
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("abc", "value of abc")
+	mpt.Insert("ab", "value of ab")
+	regression_get(t, "TestRegressionInsertPrefixOfLeaf", &mpt, "abc", "value of abc")
+	regression_get(t, "TestRegressionInsertPrefixOfLeaf", &mpt, "ab", "value of ab")
+}
+
+func TestRegressionInsertInsideExtension(t *testing.T) {
+	//the new key ends one nibble before the end of the extension path [7,1,6]
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("qa", "value of qa")
+	mpt.Insert("qb", "value of qb")
+	mpt.Insert("q", "value of q")
+	regression_get(t, "TestRegressionInsertInsideExtension", &mpt, "qa", "value of qa")
+	regression_get(t, "TestRegressionInsertInsideExtension", &mpt, "qb", "value of qb")
+	regression_get(t, "TestRegressionInsertInsideExtension", &mpt, "q", "value of q")
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecureMpt(t *testing.T) {
+	secure := p1.NewSecureMpt(p1.NewMemoryNodeStore(), p1.NewMemoryPreimageStore())
+	expected := map[string]string{}
+	//keys with long shared prefixes
+	for i := 0; i < 20; i++ {
+		key := strings.Repeat("a", 40+i)
+		secure.Insert(key, fmt.Sprint("value", i))
+		expected[key] = fmt.Sprint("value", i)
+	}
+	secure.Insert("bob", "deleted")
+	secure.Delete("bob")
+
+	v, err := secure.Get(strings.Repeat("a", 45))
+	check_eq("TestSecureMpt get", v, "value5", t)
+	if _, err = secure.Get("bob"); err == nil {
+		fmt.Println("TestSecureMpt: deleted key found")
+		t.Fail()
+	}
+	pairs, err := secure.GetMptMap()
+	if err != nil || !reflect.DeepEqual(pairs, expected) {
+		fmt.Println("TestSecureMpt: wrong pairs", err)
+		t.Fail()
+	}
+
+	//the paths are hashed: no key of the trie is an original key
+	trie := secure.Trie()
+	if _, err := trie.Get(strings.Repeat("a", 40)); err == nil {
+		fmt.Println("TestSecureMpt: original key in the trie")
+		t.Fail()
+	}
+	it := secure.NewIterator(false)
+	count := 0
+	for it.Next() {
+		key, err := it.Key()
+		if err != nil || expected[key] != it.Value() {
+			fmt.Println("TestSecureMpt: wrong iterator pair", key, err)
+			t.Fail()
+		}
+		count++
+	}
+	if count != len(expected) {
+		fmt.Println("TestSecureMpt: wrong iterator count", count)
+		t.Fail()
+	}
+}
+
+func TestSecureMptWithoutPreimages(t *testing.T) {
+	secure := p1.NewSecureMpt(p1.NewMemoryNodeStore(), nil)
+	secure.Insert("hello", "world")
+	v, _ := secure.Get("hello")
+	check_eq("TestSecureMptWithoutPreimages get", v, "world", t)
+	if _, err := secure.GetMptMap(); err == nil {
+		fmt.Println("TestSecureMptWithoutPreimages: keys without preimages")
+		t.Fail()
+	}
+}
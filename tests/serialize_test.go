@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"../p1"
+	"../p2"
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMptToByteArrayDeterministic(t *testing.T) {
+	mpt1 := p1.MerklePatriciaTrie{}
+	mpt1.Initial()
+	mpt1.Insert("hello", "world")
+	mpt1.Insert("charles", "ge")
+	mpt1.Insert("chain", "block")
+
+	//same content, different order and replaced nodes left in db
+	mpt2 := p1.MerklePatriciaTrie{}
+	mpt2.Initial()
+	mpt2.Insert("chain", "old block")
+	mpt2.Insert("temporary", "value")
+	mpt2.Insert("charles", "ge")
+	mpt2.Insert("hello", "world")
+	mpt2.Insert("chain", "block")
+	mpt2.Delete("temporary")
+
+	if !bytes.Equal(mpt1.MptToByteArray(), mpt2.MptToByteArray()) {
+		fmt.Println("TestMptToByteArrayDeterministic: different byte arrays for the same trie")
+		t.Fail()
+	}
+
+	b1 := p2.NewBlock(1, 1234567890, "genesis", mpt1)
+	b2 := p2.NewBlock(1, 1234567890, "genesis", mpt2)
+	if b1.Header.Size != b2.Header.Size {
+		fmt.Println("TestMptToByteArrayDeterministic: different sizes", b1.Header.Size, b2.Header.Size)
+		t.Fail()
+	}
+	check_eq("TestMptToByteArrayDeterministic hash", b1.Header.Hash, b2.Header.Hash, t)
+}
+
+func TestMptFromByteArray(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("a", "value of a")
+	data := mpt.MptToByteArray()
+
+	decoded, err := p1.MptFromByteArray(data)
+	if err != nil {
+		fmt.Println("TestMptFromByteArray:", err)
+		t.FailNow()
+	}
+	check_eq("TestMptFromByteArray root", decoded.GetRoot(), mpt.GetRoot(), t)
+	if !reflect.DeepEqual(decoded.GetMptMap(decoded.GetRoot(), []uint8{}), mpt.GetMptMap(mpt.GetRoot(), []uint8{})) {
+		fmt.Println("TestMptFromByteArray: different pairs")
+		t.Fail()
+	}
+
+	empty := p1.MerklePatriciaTrie{}
+	empty.Initial()
+	decoded, err = p1.MptFromByteArray(empty.MptToByteArray())
+	if err != nil || decoded.GetRoot() != "" {
+		fmt.Println("TestMptFromByteArray empty:", err)
+		t.Fail()
+	}
+
+	//a changed byte is detected
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 1
+	if _, err := p1.MptFromByteArray(corrupted); err == nil {
+		fmt.Println("TestMptFromByteArray: corrupted byte array accepted")
+		t.Fail()
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"testing"
+)
+
+func TestSessionCommit(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	start := mpt.GetRoot()
+
+	session := mpt.BeginSession()
+	session.Insert("charles", "ge")
+	session.Insert("hello", "new world")
+	check_eq("TestSessionCommit root before commit", mpt.GetRoot(), start, t)
+	v, _ := mpt.Get("hello")
+	check_eq("TestSessionCommit trie before commit", v, "world", t)
+	v, _ = session.Get("hello")
+	check_eq("TestSessionCommit session", v, "new world", t)
+
+	//nodes of an open session are live
+	mpt.CollectGarbage()
+	root, err := session.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestSessionCommit root", mpt.GetRoot(), root, t)
+	v, _ = mpt.Get("charles")
+	check_eq("TestSessionCommit after commit", v, "ge", t)
+	if err := session.Insert("a", "b"); err == nil {
+		fmt.Println("TestSessionCommit: insert in a committed session")
+		t.Fail()
+	}
+}
+
+func TestSessionRollback(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+	mpt.Insert("charles", "ge")
+	start := mpt.GetRoot()
+	live := mpt.CollectGarbage().NodesLive
+
+	session := mpt.BeginSession()
+	session.Insert("candidate", "tx1")
+	session.Delete("hello")
+	session.Insert("charles", "changed")
+	if err := session.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestSessionRollback root", mpt.GetRoot(), start, t)
+	if report := mpt.CollectGarbage(); report.NodesReclaimed != 0 || report.NodesLive != live {
+		fmt.Println("TestSessionRollback: nodes left in db", report)
+		t.Fail()
+	}
+	if _, err := session.Commit(); err == nil {
+		fmt.Println("TestSessionRollback: commit after rollback")
+		t.Fail()
+	}
+}
+
+func TestSessionConflict(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("hello", "world")
+
+	session := mpt.BeginSession()
+	session.Insert("block", "candidate")
+	mpt.Insert("hello", "written outside the session")
+	if _, err := session.Commit(); err == nil {
+		fmt.Println("TestSessionConflict: conflicting commit accepted")
+		t.Fail()
+	}
+	session.Rollback()
+	v, _ := mpt.Get("hello")
+	check_eq("TestSessionConflict trie", v, "written outside the session", t)
+	if _, err := mpt.Get("block"); err == nil {
+		fmt.Println("TestSessionConflict: rolled back key found")
+		t.Fail()
+	}
+}
+
+func TestSessionSnapshots(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("alice", "100")
+	mpt.Insert("bob", "50")
+	mpt.CollectGarbage()
+
+	session := mpt.BeginSession()
+	session.Insert("alice", "90")
+	session.Insert("bob", "60")
+	after_tx1 := session.GetRoot()
+
+	tx2 := session.Snapshot()
+	session.Insert("alice", "80")
+	session.Insert("carol", "10")
+	inner := session.Snapshot()
+	session.Delete("bob")
+	if err := session.RevertToSnapshot(inner); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := session.Get("bob")
+	check_eq("TestSessionSnapshots inner revert", v, "60", t)
+
+	//the failed transaction is reverted, the first one is kept
+	if err := session.RevertToSnapshot(tx2); err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestSessionSnapshots root", session.GetRoot(), after_tx1, t)
+	if _, err := session.Get("carol"); err == nil {
+		fmt.Println("TestSessionSnapshots: reverted key found")
+		t.Fail()
+	}
+	if err := session.RevertToSnapshot(inner); err == nil {
+		fmt.Println("TestSessionSnapshots: discarded snapshot reverted")
+		t.Fail()
+	}
+
+	session.Insert("dave", "5")
+	root, _ := session.Commit()
+	expected := p1.MerklePatriciaTrie{}
+	expected.Initial()
+	expected.Insert("alice", "90")
+	expected.Insert("bob", "60")
+	expected.Insert("dave", "5")
+	check_eq("TestSessionSnapshots commit", root, expected.GetRoot(), t)
+
+	//the nodes of the reverted changes were deleted: same orphans as a session without them
+	reference := p1.MerklePatriciaTrie{}
+	reference.Initial()
+	reference.Insert("alice", "100")
+	reference.Insert("bob", "50")
+	reference.CollectGarbage()
+	kept := reference.BeginSession()
+	kept.Insert("alice", "90")
+	kept.Insert("bob", "60")
+	kept.Insert("dave", "5")
+	kept.Commit()
+	report, expected_report := mpt.CollectGarbage(), reference.CollectGarbage()
+	if report != expected_report {
+		fmt.Println("TestSessionSnapshots: reverted nodes left in db", report, expected_report)
+		t.Fail()
+	}
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMptStats(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("a", "value of a")
+	mpt.Insert("b", "new")
+	mpt.Delete("b")
+
+	//branch(6: ext(1) -> branch(value of a, 6: leaf, 7: leaf), 7: leaf(0))
+	stats := mpt.Stats()
+	expected := p1.MptStats{
+		BranchNodes:    2,
+		ExtensionNodes: 1,
+		LeafNodes:      3,
+		EncodedBytes:   stats.EncodedBytes,
+		Keys:           4,
+		KeyBytes:       6,
+		ValueBytes:     27,
+		MaxDepth:       4,
+		AverageDepth:   3.25,
+		DepthHistogram: map[int]int{2: 1, 3: 1, 4: 2},
+		OrphanNodes:    stats.OrphanNodes,
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		fmt.Println("TestMptStats:", stats)
+		t.Fail()
+	}
+	if stats.EncodedBytes == 0 || stats.OrphanNodes == 0 {
+		fmt.Println("TestMptStats: no sizes or orphans", stats)
+		t.Fail()
+	}
+	mpt.CollectGarbage()
+	check_eq("TestMptStats orphans after gc", fmt.Sprint(mpt.Stats().OrphanNodes), "0", t)
+
+	empty := p1.MerklePatriciaTrie{}
+	empty.Initial()
+	check_eq("TestMptStats empty", fmt.Sprint(empty.Stats().Keys), "0", t)
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNodeStoreReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpt_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("b", "new")
+	mpt.Delete("b")
+	root := mpt.GetRoot()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := p1.OpenMpt(store, root)
+	if err != nil {
+		fmt.Println("OpenMpt failed:", err)
+		t.FailNow()
+	}
+	check_eq("TestFileNodeStoreReopen root", reopened.GetRoot(), root, t)
+	for key, expected := range map[string]string{"p": "apple", "aa": "banana", "ap": "orange"} {
+		v, err := reopened.Get(key)
+		if err != nil {
+			fmt.Println("Get failed:", key, err)
+			t.Fail()
+		}
+		check_eq("TestFileNodeStoreReopen "+key, v, expected, t)
+	}
+	if _, err := reopened.Get("b"); err == nil {
+		fmt.Println("deleted key found after reopen")
+		t.Fail()
+	}
+
+	//the reopened trie can still be modified
+	reopened.Insert("c", "cherry")
+	v, _ := reopened.Get("c")
+	check_eq("TestFileNodeStoreReopen insert", v, "cherry", t)
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenMptMissingRoot(t *testing.T) {
+	store := p1.NewMemoryNodeStore()
+	if _, err := p1.OpenMpt(store, "HashStart_missing_HashEnd"); err == nil {
+		fmt.Println("OpenMpt accepted a missing root")
+		t.Fail()
+	}
+	mpt, err := p1.OpenMpt(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt.Insert("a", "apple")
+	v, _ := mpt.Get("a")
+	check_eq("TestOpenMptMissingRoot", v, "apple", t)
+}
+
+func TestFileNodeStoreReplayAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpt_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("hello", "world")
+	mpt.Insert("help", "me")
+	root := mpt.GetRoot()
+	//the process stops: no Flush, no Close
+
+	wal := filepath.Join(dir, "nodes.wal")
+	info, err := os.Stat(wal)
+	if err != nil || info.Size() == 0 {
+		fmt.Println("TestFileNodeStoreReplayAfterCrash: empty log", err)
+		t.FailNow()
+	}
+	//a record cut off by the crash
+	file, err := os.OpenFile(wal, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"op\":\"put\",\"hash\":\"HashStart_")
+	file.Close()
+
+	reopened_store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened_store.Close()
+	after, _ := os.Stat(wal)
+	check_eq("TestFileNodeStoreReplayAfterCrash truncated", fmt.Sprint(after.Size()), fmt.Sprint(info.Size()), t)
+	reopened, err := p1.OpenMpt(reopened_store, root)
+	if err != nil {
+		fmt.Println("TestFileNodeStoreReplayAfterCrash OpenMpt:", err)
+		t.FailNow()
+	}
+	for key, expected := range map[string]string{"hello": "world", "help": "me"} {
+		v, _ := reopened.Get(key)
+		check_eq("TestFileNodeStoreReplayAfterCrash "+key, v, expected, t)
+	}
+}
+
+func TestFileNodeStoreMaxPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpt_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetMaxPending(16)
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	for i := 0; i < 200; i++ {
+		mpt.Insert(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	//the nodes went to the data file without a Flush
+	info, err := os.Stat(filepath.Join(dir, "nodes.dat"))
+	if err != nil || info.Size() == 0 {
+		fmt.Println("TestFileNodeStoreMaxPending: no automatic flush", err)
+		t.Fail()
+	}
+	root := mpt.GetRoot()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := p1.OpenMpt(store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i += 17 {
+		v, _ := reopened.Get(fmt.Sprintf("key%d", i))
+		check_eq("TestFileNodeStoreMaxPending", v, fmt.Sprintf("value%d", i), t)
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"../p1"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+/**
+A peer that goes away after serving limit nodes, or that corrupts the nodes it serves.
+ */
+type flaky_fetcher struct {
+	peer    p1.NodeFetcher
+	limit   int
+	corrupt bool
+}
+
+func (fetcher *flaky_fetcher) Fetch(hashes []string) ([][]byte, error) {
+	if fetcher.limit < len(hashes) {
+		return nil, errors.New("peer disconnected")
+	}
+	fetcher.limit -= len(hashes)
+	data, err := fetcher.peer.Fetch(hashes)
+	if fetcher.corrupt {
+		for _, node := range data {
+			node[len(node)-1] ^= 1
+		}
+	}
+	return data, err
+}
+
+func sync_source() p1.MerklePatriciaTrie {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	for i := 0; i < 300; i++ {
+		mpt.Insert("account"+strconv.Itoa(i), "balance"+strconv.Itoa(i))
+	}
+	return mpt
+}
+
+func TestMptSync(t *testing.T) {
+	source := sync_source()
+	store := p1.NewMemoryNodeStore()
+	sync := p1.NewMptSync(source.GetRoot(), store)
+	if err := sync.Run(p1.NewTrieFetcher(&source), 16); err != nil {
+		t.Fatal(err)
+	}
+	synced, err := sync.Trie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestMptSync root", synced.GetRoot(), source.GetRoot(), t)
+	if !reflect.DeepEqual(synced.GetMptMap(synced.GetRoot(), []uint8{}), source.GetMptMap(source.GetRoot(), []uint8{})) {
+		fmt.Println("TestMptSync: different pairs")
+		t.Fail()
+	}
+	if !synced.Verify().Ok() {
+		fmt.Println("TestMptSync: synced trie not valid")
+		t.Fail()
+	}
+}
+
+func TestMptSyncResume(t *testing.T) {
+	source := sync_source()
+	store := p1.NewMemoryNodeStore()
+	sync := p1.NewMptSync(source.GetRoot(), store)
+	if err := sync.Run(&flaky_fetcher{peer: p1.NewTrieFetcher(&source), limit: 100}, 10); err == nil {
+		t.Fatal("TestMptSyncResume: the sync didn't stop")
+	}
+	if _, err := sync.Trie(); err == nil {
+		fmt.Println("TestMptSyncResume: incomplete trie opened")
+		t.Fail()
+	}
+	first := sync.Fetched()
+
+	//a new sync on the same store only fetches the missing nodes
+	resumed := p1.NewMptSync(source.GetRoot(), store)
+	if err := resumed.Run(p1.NewTrieFetcher(&source), 10); err != nil {
+		t.Fatal(err)
+	}
+	synced, _ := resumed.Trie()
+	check_eq("TestMptSyncResume root", synced.GetRoot(), source.GetRoot(), t)
+	check_eq("TestMptSyncResume fetched", strconv.Itoa(first+resumed.Fetched()), strconv.Itoa(len(store.Hashes())), t)
+}
+
+func TestMptSyncInvalidNodes(t *testing.T) {
+	source := sync_source()
+	store := p1.NewMemoryNodeStore()
+	sync := p1.NewMptSync(source.GetRoot(), store)
+	if err := sync.Step(&flaky_fetcher{peer: p1.NewTrieFetcher(&source), limit: 10, corrupt: true}, 10); err == nil {
+		fmt.Println("TestMptSyncInvalidNodes: corrupted node accepted")
+		t.Fail()
+	}
+	if len(store.Hashes()) != 0 || !reflect.DeepEqual(sync.Missing(), []string{source.GetRoot()}) {
+		fmt.Println("TestMptSyncInvalidNodes: corrupted node stored")
+		t.Fail()
+	}
+	empty := p1.MerklePatriciaTrie{}
+	empty.Initial()
+	if err := sync.Step(p1.NewTrieFetcher(&empty), 10); err == nil {
+		fmt.Println("TestMptSyncInvalidNodes: missing node accepted")
+		t.Fail()
+	}
+}
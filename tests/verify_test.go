@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"../p1"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func count_issues(report p1.VerifyReport, kind p1.VerifyIssueKind) int {
+	count := 0
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func TestVerifyValidTrie(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	mpt.Insert("a", "value of a")
+	mpt.Insert("b", "new")
+	mpt.Delete("p")
+	report := mpt.Verify()
+	if !report.Ok() || report.NodesChecked == 0 {
+		fmt.Println("TestVerifyValidTrie:", report)
+		t.Fail()
+	}
+}
+
+func TestVerifyTamperedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpt_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.InitialWithStore(store)
+	mpt.Insert("hello", "world")
+	mpt.Insert("charles", "ge")
+	mpt.Insert("chain", "block")
+	root := mpt.GetRoot()
+	store.Close()
+
+	//a value changed on disk
+	file := filepath.Join(dir, "nodes.dat")
+	data, _ := ioutil.ReadFile(file)
+	ioutil.WriteFile(file, bytes.Replace(data, []byte(`"value":"world"`), []byte(`"value":"WORLD"`), -1), 0644)
+	store, err = p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, _ := p1.OpenMpt(store, root)
+	//Get returns the wrong answer, Verify finds it
+	v, _ := reopened.Get("hello")
+	check_eq("TestVerifyTamperedStore get", v, "WORLD", t)
+	report := reopened.Verify()
+	if count_issues(report, p1.IssueHashMismatch) != 1 || len(report.Issues) != 1 {
+		fmt.Println("TestVerifyTamperedStore: wrong issues", report.Issues)
+		t.Fail()
+	}
+
+	//a missing child: the leaf of "chain"
+	for _, hash := range store.Hashes() {
+		pairs := reopened.GetMptMap(hash, []uint8{})
+		for _, value := range pairs {
+			if len(pairs) == 1 && value == "block" {
+				store.Delete(hash)
+			}
+		}
+	}
+	if count_issues(reopened.Verify(), p1.IssueMissingNode) != 1 {
+		fmt.Println("TestVerifyTamperedStore: missing node not found", reopened.Verify().Issues)
+		t.Fail()
+	}
+}
+
+func TestVerifyMalformedNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpt_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hash := func(name string) string {
+		return "HashStart_" + strings.Repeat(name, 64) + "_HashEnd"
+	}
+	branch := func(children map[int]string) string {
+		values := make([]string, 17)
+		for i, child := range children {
+			values[i] = `"` + child + `"`
+		}
+		for i := range values {
+			if values[i] == "" {
+				values[i] = `""`
+			}
+		}
+		return `{"type":1,"branch":[` + strings.Join(values, ",") + `]}`
+	}
+	records := []string{
+		`{"op":"put","hash":"` + hash("1") + `","node":` + branch(map[int]string{1: hash("2"), 2: hash("9")}) + `}`,
+		`{"op":"put","hash":"` + hash("2") + `","node":{"type":2,"prefix":[0,97],"value":"` + hash("3") + `"}}`,
+		`{"op":"put","hash":"` + hash("3") + `","node":{"type":2,"prefix":[0,98],"value":"` + hash("4") + `"}}`,
+		`{"op":"put","hash":"` + hash("4") + `","node":` + branch(map[int]string{5: hash("5")}) + `}`,
+		`{"op":"put","hash":"` + hash("5") + `","node":{"type":2,"prefix":[80,97],"value":"leaf"}}`,
+	}
+	ioutil.WriteFile(filepath.Join(dir, "nodes.dat"), []byte(strings.Join(records, "\n")+"\n"), 0644)
+	store, err := p1.OpenFileNodeStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	mpt, err := p1.OpenMpt(store, hash("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := mpt.Verify()
+	expected := map[p1.VerifyIssueKind]int{
+		p1.IssueHashMismatch:         5,
+		p1.IssueMissingNode:          1,
+		p1.IssueExtensionChild:       1,
+		p1.IssueBranchTooFewChildren: 1,
+		p1.IssueBadCompactPrefix:     1,
+	}
+	for kind, count := range expected {
+		if count_issues(report, kind) != count {
+			fmt.Println("TestVerifyMalformedNodes: wrong count for", kind, report.Issues)
+			t.Fail()
+		}
+	}
+	check_eq("TestVerifyMalformedNodes nodes", fmt.Sprint(report.NodesChecked), "5", t)
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"../p1"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestVersionedViews(t *testing.T) {
+	mpt := p1.MerklePatriciaTrie{}
+	mpt.Initial()
+	mpt.Insert("p", "apple")
+	mpt.Insert("aa", "banana")
+	mpt.Insert("ap", "orange")
+	root0, err := mpt.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mpt.Insert("aa", "grape")
+	mpt.Delete("p")
+	mpt.Insert("b", "new")
+	root1, _ := mpt.Commit()
+	mpt.Insert("c", "not committed")
+
+	versions := mpt.GetVersions()
+	if !reflect.DeepEqual(versions, []string{root0, root1}) {
+		fmt.Println("wrong versions:", versions)
+		t.Fail()
+	}
+
+	view0, err := mpt.ViewAt(root0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected0 := map[string]string{"p": "apple", "aa": "banana", "ap": "orange"}
+	if !reflect.DeepEqual(view0.GetMptMap(), expected0) {
+		fmt.Println("wrong version 0:", view0.GetMptMap())
+		t.Fail()
+	}
+	view1, err := mpt.ViewAtVersion(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check_eq("TestVersionedViews root1", view1.GetRoot(), root1, t)
+	expected1 := map[string]string{"aa": "grape", "ap": "orange", "b": "new"}
+	if !reflect.DeepEqual(view1.GetMptMap(), expected1) {
+		fmt.Println("wrong version 1:", view1.GetMptMap())
+		t.Fail()
+	}
+	v, _ := mpt.Get("c")
+	check_eq("TestVersionedViews current", v, "not committed", t)
+
+	//proofs against an old root still verify
+	value, exists, err := p1.VerifyProof(root0, "p", view0.GetProof("p"))
+	if err != nil || !exists || value != "apple" {
+		fmt.Println("proof on version 0 failed:", value, exists, err)
+		t.Fail()
+	}
+
+	if _, err := mpt.ViewAt(mpt.GetRoot()); err == nil {
+		fmt.Println("view opened at a root that was not committed")
+		t.Fail()
+	}
+	if _, err := mpt.ViewAtVersion(2); err == nil {
+		fmt.Println("view opened at a version that doesn't exist")
+		t.Fail()
+	}
+}